@@ -1,15 +1,34 @@
 package generator
 
 import (
+	"fmt"
+	"slices"
 	"strings"
+
+	"mermaid-icepanel/internal/config"
 )
 
-// ServiceClassifier provides methods to classify services based on naming conventions.
+// ServiceClassifier provides methods to classify services based on rules and
+// naming conventions.
 type ServiceClassifier struct {
 	// Prefixes or suffixes that indicate external systems
 	ExternalPatterns []string
 	// Prefixes or suffixes that indicate database systems
 	DatabasePatterns []string
+	// Lower-case words in a service comment that indicate external systems
+	ExternalTerms []string
+	// Lower-case words in a service comment that indicate database systems
+	DatabaseTerms []string
+	// Rules tried in order before the patterns and terms; see LoadRules
+	Rules []*Rule
+}
+
+// Classification is the outcome of classifying a service.
+type Classification struct {
+	Type       C4ObjectType
+	Tags       []string // from the matching rule
+	Technology string   // from the matching rule
+	Reason     string   // why the type was chosen, for explain output
 }
 
 // NewDefaultClassifier creates a classifier with default classification patterns.
@@ -21,64 +40,80 @@ func NewDefaultClassifier() *ServiceClassifier {
 		DatabasePatterns: []string{
 			"Database", "DB", "Repository", "Storage", "Persistence",
 		},
+		ExternalTerms: []string{
+			"external", "third-party", "integration", "external service",
+		},
+		DatabaseTerms: []string{
+			"database", "persistence", "storage", "repository",
+		},
 	}
 }
 
-// ClassifyService determines the appropriate C4 object type for a service.
-func (c *ServiceClassifier) ClassifyService(serviceName string) C4ObjectType {
-	// Check for database indicators
-	for _, pattern := range c.DatabasePatterns {
-		if strings.Contains(serviceName, pattern) {
-			return C4SystemDb
-		}
+// NewClassifier creates a classifier from configured patterns, keeping the
+// default patterns for any list that is not configured.
+func NewClassifier(patterns config.Classifier) *ServiceClassifier {
+	c := NewDefaultClassifier()
+	if len(patterns.ExternalPatterns) > 0 {
+		c.ExternalPatterns = patterns.ExternalPatterns
 	}
+	if len(patterns.DatabasePatterns) > 0 {
+		c.DatabasePatterns = patterns.DatabasePatterns
+	}
+	return c
+}
 
-	// Check for external system indicators
-	for _, pattern := range c.ExternalPatterns {
-		if strings.Contains(serviceName, pattern) {
-			return C4SystemExt
+// Evaluate classifies a service with the first matching rule, falling back to
+// the comment terms and name patterns for the type if the rule sets none.
+func (c *ServiceClassifier) Evaluate(svc ServiceInfo) Classification {
+	i := slices.IndexFunc(c.Rules, func(r *Rule) bool { return r.Matches(svc) })
+	if i < 0 {
+		return c.heuristic(svc.Name, svc.Comment)
+	}
+	rule := c.Rules[i]
+	if rule.Type != "" {
+		return Classification{
+			Type:       rule.Type,
+			Tags:       rule.Tags,
+			Technology: rule.Technology,
+			Reason:     "rule " + rule.String(),
 		}
 	}
-
-	// Default to internal system
-	return C4System
+	cls := c.heuristic(svc.Name, svc.Comment)
+	cls.Tags, cls.Technology = rule.Tags, rule.Technology
+	cls.Reason = fmt.Sprintf("%s; rule %s", cls.Reason, rule)
+	return cls
 }
 
-// ClassifyBasedOnComment uses service documentation to help classify services.
-func (c *ServiceClassifier) ClassifyBasedOnComment(comment string) C4ObjectType {
+// heuristic classifies a service by its comment, then its name.
+func (c *ServiceClassifier) heuristic(serviceName, comment string) Classification {
 	lowerComment := strings.ToLower(comment)
-
-	// Check for database indicators in comments
-	dbTerms := []string{"database", "persistence", "storage", "repository"}
-	for _, term := range dbTerms {
-		if strings.Contains(lowerComment, term) {
-			return C4SystemDb
+	for _, terms := range []struct {
+		words []string
+		typ   C4ObjectType
+	}{
+		{c.DatabaseTerms, C4SystemDb},
+		{c.ExternalTerms, C4SystemExt},
+	} {
+		for _, term := range terms.words {
+			if strings.Contains(lowerComment, term) {
+				return Classification{Type: terms.typ, Reason: fmt.Sprintf("comment mentions %q", term)}
+			}
 		}
 	}
 
-	// Check for external system indicators in comments
-	extTerms := []string{"external", "third-party", "integration", "external service"}
-	for _, term := range extTerms {
-		if strings.Contains(lowerComment, term) {
-			return C4SystemExt
+	for _, patterns := range []struct {
+		names []string
+		typ   C4ObjectType
+	}{
+		{c.DatabasePatterns, C4SystemDb},
+		{c.ExternalPatterns, C4SystemExt},
+	} {
+		for _, pattern := range patterns.names {
+			if strings.Contains(serviceName, pattern) {
+				return Classification{Type: patterns.typ, Reason: fmt.Sprintf("name contains %q", pattern)}
+			}
 		}
 	}
 
-	// If no indicators found in the comment, return unknown
-	// which means the name-based classification should be used
-	return ""
-}
-
-// ClassifyService is a package-level function that uses the default classifier.
-func ClassifyService(serviceName, comment string) C4ObjectType {
-	classifier := NewDefaultClassifier()
-
-	// First try to classify based on comments
-	commentType := classifier.ClassifyBasedOnComment(comment)
-	if commentType != "" {
-		return commentType
-	}
-
-	// If comment doesn't provide classification, use name-based classification
-	return classifier.ClassifyService(serviceName)
+	return Classification{Type: C4System, Reason: "default"}
 }
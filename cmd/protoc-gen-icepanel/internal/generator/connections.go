@@ -0,0 +1,124 @@
+package generator
+
+import (
+	"fmt"
+
+	"mermaid-icepanel/cmd/protoc-gen-icepanel/objectsfile"
+
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Origins of an inferred connection.
+const (
+	// OriginMessage marks a connection inferred from an RPC request or response
+	// message that refers to a type in another service's package.
+	OriginMessage = "message-reference"
+	// OriginImport marks a connection inferred from a proto file importing
+	// another service's package.
+	OriginImport = "import"
+)
+
+// C4Connection is a candidate relationship between two services.
+type C4Connection struct {
+	ID         string // Unique identifier.
+	From       string // ID of the calling service.
+	To         string // ID of the service depended on.
+	Label      string // Display label.
+	Origin     string // One of the Origin constants.
+	Confidence string // One of the objectsfile Confidence constants.
+	Evidence   string // The reference the connection was inferred from.
+}
+
+// inferConnections finds candidate connections between the services of the
+// files being generated. A service is connected to every service in another
+// package that its methods' messages refer to, or that its file imports.
+// Each pair of services is connected once, with the strongest evidence found.
+func inferConnections(files []*protogen.File) []C4Connection {
+	services := make(map[protoreflect.FullName][]*protogen.Service)
+	for _, file := range files {
+		if file.Generate {
+			services[file.Desc.Package()] = append(services[file.Desc.Package()], file.Services...)
+		}
+	}
+
+	var conns []C4Connection
+	index := make(map[string]int) // connection ID to position in conns
+	add := func(from *protogen.Service, pkg protoreflect.FullName, origin, confidence, evidence string) {
+		for _, to := range services[pkg] {
+			c := C4Connection{
+				ID:         "conn-" + serviceID(from) + "--" + serviceID(to),
+				From:       serviceID(from),
+				To:         serviceID(to),
+				Label:      "Uses",
+				Origin:     origin,
+				Confidence: confidence,
+				Evidence:   evidence,
+			}
+			if i, ok := index[c.ID]; ok {
+				if objectsfile.ConfidenceRank(confidence) > objectsfile.ConfidenceRank(conns[i].Confidence) {
+					conns[i] = c
+				}
+				continue
+			}
+			index[c.ID] = len(conns)
+			conns = append(conns, c)
+		}
+	}
+
+	for _, file := range files {
+		if !file.Generate {
+			continue
+		}
+		pkg := file.Desc.Package()
+		for _, service := range file.Services {
+			for _, method := range service.Methods {
+				for _, msg := range []protoreflect.MessageDescriptor{method.Input.Desc, method.Output.Desc} {
+					if p := msg.ParentFile().Package(); p != pkg {
+						add(service, p, OriginMessage, objectsfile.ConfidenceHigh,
+							fmt.Sprintf("%s uses %s", method.Desc.FullName(), msg.FullName()))
+					}
+					for _, ref := range referencedTypes(msg) {
+						if p := ref.ParentFile().Package(); p != pkg {
+							add(service, p, OriginMessage, objectsfile.ConfidenceMedium,
+								fmt.Sprintf("%s refers to %s", msg.FullName(), ref.FullName()))
+						}
+					}
+				}
+			}
+			imports := file.Desc.Imports()
+			for i := range imports.Len() {
+				if imp := imports.Get(i); imp.Package() != pkg {
+					add(service, imp.Package(), OriginImport, objectsfile.ConfidenceLow,
+						fmt.Sprintf("%s imports %s", file.Desc.Path(), imp.Path()))
+				}
+			}
+		}
+	}
+	return conns
+}
+
+// referencedTypes returns the message and enum types of the fields of msg and,
+// recursively, of the messages it refers to.
+func referencedTypes(msg protoreflect.MessageDescriptor) []protoreflect.Descriptor {
+	var refs []protoreflect.Descriptor
+	seen := map[protoreflect.FullName]bool{msg.FullName(): true}
+	var walk func(protoreflect.MessageDescriptor)
+	walk = func(m protoreflect.MessageDescriptor) {
+		fields := m.Fields()
+		for i := range fields.Len() {
+			field := fields.Get(i)
+			if e := field.Enum(); e != nil && !seen[e.FullName()] {
+				seen[e.FullName()] = true
+				refs = append(refs, e)
+			}
+			if fm := field.Message(); fm != nil && !seen[fm.FullName()] {
+				seen[fm.FullName()] = true
+				refs = append(refs, fm)
+				walk(fm)
+			}
+		}
+	}
+	walk(msg)
+	return refs
+}
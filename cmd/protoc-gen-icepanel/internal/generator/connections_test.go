@@ -0,0 +1,105 @@
+package generator
+
+import (
+	"reflect"
+	"testing"
+
+	"mermaid-icepanel/cmd/protoc-gen-icepanel/objectsfile"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// protoFile describes a test proto file with messages and one service.
+type protoFile struct {
+	name, pkg string
+	imports   []string
+	messages  map[string][]string // message name to the fully qualified types of its fields
+	service   string
+	methods   [][2]string // request and response types
+}
+
+func (p protoFile) descriptor() *descriptorpb.FileDescriptorProto {
+	f := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String(p.name),
+		Package:    proto.String(p.pkg),
+		Syntax:     proto.String("proto3"),
+		Dependency: p.imports,
+	}
+	for name, fields := range p.messages {
+		msg := &descriptorpb.DescriptorProto{Name: proto.String(name)}
+		for i, typ := range fields {
+			msg.Field = append(msg.Field, &descriptorpb.FieldDescriptorProto{
+				Name:     proto.String(string(rune('a' + i))),
+				Number:   proto.Int32(int32(i + 1)),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+				TypeName: proto.String("." + typ),
+			})
+		}
+		f.MessageType = append(f.MessageType, msg)
+	}
+	if p.service != "" {
+		svc := &descriptorpb.ServiceDescriptorProto{Name: proto.String(p.service)}
+		for i, m := range p.methods {
+			svc.Method = append(svc.Method, &descriptorpb.MethodDescriptorProto{
+				Name:       proto.String(string(rune('A' + i))),
+				InputType:  proto.String("." + m[0]),
+				OutputType: proto.String("." + m[1]),
+			})
+		}
+		f.Service = []*descriptorpb.ServiceDescriptorProto{svc}
+	}
+	return f
+}
+
+func TestGenerate_Connections(t *testing.T) {
+	files := []protoFile{
+		{name: "common/v1/money.proto", pkg: "common.v1", messages: map[string][]string{"Money": nil}},
+		{name: "users/v1/users.proto", pkg: "users.v1", messages: map[string][]string{"User": nil},
+			service: "Users", methods: [][2]string{{"users.v1.User", "users.v1.User"}}},
+		{name: "billing/v1/billing.proto", pkg: "billing.v1", imports: []string{"common/v1/money.proto"},
+			messages: map[string][]string{"Invoice": {"common.v1.Money"}},
+			service:  "Billing", methods: [][2]string{{"billing.v1.Invoice", "billing.v1.Invoice"}}},
+		{name: "inventory/v1/inventory.proto", pkg: "inventory.v1", messages: map[string][]string{"Item": nil},
+			service: "Inventory", methods: [][2]string{{"inventory.v1.Item", "inventory.v1.Item"}}},
+		{name: "shop/v1/orders.proto", pkg: "shop.v1",
+			imports: []string{
+				"users/v1/users.proto", "billing/v1/billing.proto", "inventory/v1/inventory.proto",
+			},
+			messages: map[string][]string{
+				"Order":       {"shop.v1.LineItem"},
+				"LineItem":    {"users.v1.User"},
+				"OrderResult": nil,
+			},
+			service: "Orders",
+			methods: [][2]string{{"shop.v1.Order", "billing.v1.Invoice"}, {"shop.v1.Order", "shop.v1.OrderResult"}}},
+	}
+	var descs []*descriptorpb.FileDescriptorProto
+	for _, f := range files {
+		descs = append(descs, f.descriptor())
+	}
+
+	if f := generate(t, newRequest("", descs...)); len(f.Connections) != 0 {
+		t.Errorf("connections without the option = %+v", f.Connections)
+	}
+
+	f := generate(t, newRequest("connections=true", descs...))
+	want := []objectsfile.Connection{
+		{ID: "conn-service-shop-v1-orders--service-users-v1-users",
+			FromID: "service-shop-v1-orders", ToID: "service-users-v1-users",
+			Label: "Uses", Origin: OriginMessage, Confidence: objectsfile.ConfidenceMedium,
+			Evidence: "shop.v1.Order refers to users.v1.User"},
+		{ID: "conn-service-shop-v1-orders--service-billing-v1-billing",
+			FromID: "service-shop-v1-orders", ToID: "service-billing-v1-billing",
+			Label: "Uses", Origin: OriginMessage, Confidence: objectsfile.ConfidenceHigh,
+			Evidence: "shop.v1.Orders.A uses billing.v1.Invoice"},
+		{ID: "conn-service-shop-v1-orders--service-inventory-v1-inventory",
+			FromID: "service-shop-v1-orders", ToID: "service-inventory-v1-inventory",
+			Label: "Uses", Origin: OriginImport, Confidence: objectsfile.ConfidenceLow,
+			Evidence: "shop/v1/orders.proto imports inventory/v1/inventory.proto"},
+	}
+	if !reflect.DeepEqual(f.Connections, want) {
+		t.Errorf("Connections = %+v\nwant %+v", f.Connections, want)
+	}
+}
@@ -2,10 +2,19 @@
 package generator
 
 import (
+	"cmp"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
+	"text/tabwriter"
+
+	"mermaid-icepanel/cmd/protoc-gen-icepanel/objectsfile"
+	"mermaid-icepanel/internal/config"
+	"mermaid-icepanel/proto/icepanel"
 
 	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/pluginpb"
 )
 
@@ -21,6 +30,16 @@ const (
 	C4SystemDb C4ObjectType = "SystemDb"
 	// C4SystemBoundary represents a package/namespace boundary.
 	C4SystemBoundary C4ObjectType = "System_Boundary"
+	// C4Component represents an RPC method of a service.
+	C4Component C4ObjectType = "Component"
+)
+
+// Streaming modes of an RPC method.
+const (
+	StreamingNone   = "unary"
+	StreamingClient = "client"
+	StreamingServer = "server"
+	StreamingBidi   = "bidi"
 )
 
 // C4Object represents an object in the C4 model.
@@ -32,6 +51,21 @@ type C4Object struct {
 	Technology    string       // Technology stack (if applicable).
 	Package       string       // Package/namespace.
 	IsSpeculative bool         // True if derived from tdd/protos/.
+	Parent        string       // ID of the enclosing object, for components.
+	Method        *Method      // RPC signature, for components.
+	Owner         string       // Owning team, from the IcePanel options.
+	Tags          []string     // Tags, from the IcePanel options.
+	Links         []Link       // Links, from the IcePanel options.
+	Reason        string       // Why the type was chosen, for services.
+	FullName      string       // Fully qualified proto name of the package, service or method.
+	File          string       // Path of the proto file the object was extracted from.
+}
+
+// Method describes the signature of an RPC method.
+type Method struct {
+	Request   string // Fully qualified request message name.
+	Response  string // Fully qualified response message name.
+	Streaming string // One of the Streaming constants.
 }
 
 // Options contains parameters for the generator.
@@ -39,39 +73,54 @@ type Options struct {
 	LandscapeID string // IcePanel landscape ID.
 	VersionID   string // IcePanel version ID.
 	Wipe        bool   // Whether to wipe existing content before importing.
+	Profile     string // Config profile to read classifier patterns from.
+	Components  bool   // Whether to emit each RPC method as a component of its service.
+	Connections bool   // Whether to emit connections inferred between services.
+	Rules       string // Path of a classification rule file; see LoadRules.
+	Explain     bool   // Whether to write how each service was classified.
+
+	SpeculativePathPrefix string // Proto files under this path are marked speculative.
 }
 
 // Generate processes the CodeGeneratorRequest and returns a CodeGeneratorResponse.
+// Problems with the request, such as bad parameters, invalid IcePanel options,
+// bad rule files or colliding object IDs, are reported in the response's
+// Error field, which protoc prints; the returned error is for internal failures.
 func Generate(req *pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorResponse, error) {
-	plugin, err := protogen.Options{}.New(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create protogen plugin: %w", err)
-	}
-
-	// Parse parameters for speculative paths
-	speculativePathPrefix := ""
-	params := plugin.Request.GetParameter()
-	if params != "" {
-		parts := strings.Split(params, ",")
-		for _, part := range parts {
-			kv := strings.SplitN(part, "=", 2)
-			if len(kv) == 2 && kv[0] == "speculative_protos_path_prefix" {
-				speculativePathPrefix = kv[1]
-				break
-			}
-		}
+	features := uint64(pluginpb.CodeGeneratorResponse_FEATURE_PROTO3_OPTIONAL)
+	resp := &pluginpb.CodeGeneratorResponse{
+		SupportedFeatures: &features,
+	}
+	fail := func(err error) (*pluginpb.CodeGeneratorResponse, error) {
+		resp.Error = stringPtr(err.Error())
+		return resp, nil
 	}
 
-	plugin.SupportedFeatures = uint64(pluginpb.CodeGeneratorResponse_FEATURE_PROTO3_OPTIONAL)
-
-	resp := &pluginpb.CodeGeneratorResponse{
-		SupportedFeatures: &plugin.SupportedFeatures,
+	plugin, err := protogen.Options{}.New(req)
+	if err != nil {
+		return fail(fmt.Errorf("failed to create protogen plugin: %w", err))
 	}
 
 	// Parse plugin parameters for IcePanel options
 	options, err := parsePluginParameters(req.GetParameter())
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse plugin parameters: %w", err)
+		return fail(fmt.Errorf("failed to parse plugin parameters: %w", err))
+	}
+
+	// Classify services with the patterns from the profile named by the
+	// profile= parameter; without one, no config file is read
+	classifier := NewDefaultClassifier()
+	if options.Profile != "" {
+		profile, err := config.LoadProfile(options.Profile)
+		if err != nil {
+			return fail(fmt.Errorf("failed to load profile: %w", err))
+		}
+		classifier = NewClassifier(profile.Classifier)
+	}
+	if options.Rules != "" {
+		if classifier.Rules, err = LoadRules(options.Rules); err != nil {
+			return fail(err)
+		}
 	}
 
 	// Track all extracted objects
@@ -84,22 +133,63 @@ func Generate(req *pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorRespon
 		}
 
 		// Extract objects from proto file
-		fileObjects := processProtoFile(file, speculativePathPrefix)
+		fileObjects, err := processProtoFile(file, options, classifier)
+		if err != nil {
+			return fail(err)
+		}
 		objects = append(objects, fileObjects...)
 	}
 
+	objects, err = checkIDs(objects)
+	if err != nil {
+		return fail(err)
+	}
+
+	var connections []C4Connection
+	if options.Connections {
+		connections = inferConnections(plugin.Files)
+	}
+
 	// Generate output file with IcePanel API calls
 	if len(objects) > 0 {
-		content := generateIcePanelOutput(objects, options)
+		content, err := generateIcePanelOutput(objects, connections, options)
+		if err != nil {
+			return nil, err
+		}
 		resp.File = append(resp.File, &pluginpb.CodeGeneratorResponse_File{
-			Name:    stringPtr("icepanel_objects.json"),
+			Name:    stringPtr(objectsfile.Name),
 			Content: stringPtr(content),
 		})
 	}
 
+	// Explain how each service was classified
+	if options.Explain {
+		resp.File = append(resp.File, &pluginpb.CodeGeneratorResponse_File{
+			Name:    stringPtr(ExplainFile),
+			Content: stringPtr(explain(objects)),
+		})
+	}
+
 	return resp, nil
 }
 
+// ExplainFile is the file written by the explain=true plugin parameter.
+const ExplainFile = "icepanel_explain.txt"
+
+// explain lists each service with its type and the reason it was chosen.
+func explain(objects []C4Object) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVICE\tTYPE\tREASON")
+	for _, obj := range objects {
+		if obj.Reason != "" {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", obj.FullName, obj.Type, obj.Reason)
+		}
+	}
+	_ = w.Flush() // writes to a strings.Builder cannot fail
+	return b.String()
+}
+
 // parsePluginParameters parses the plugin parameters passed from protoc.
 func parsePluginParameters(paramString string) (*Options, error) {
 	options := &Options{}
@@ -123,28 +213,53 @@ func parsePluginParameters(paramString string) (*Options, error) {
 			options.VersionID = value
 		case "wipe":
 			options.Wipe = value == "true" || value == "1" || value == "yes"
+		case "profile":
+			options.Profile = value
+		case "components":
+			options.Components = value == "true" || value == "1" || value == "yes"
+		case "connections":
+			options.Connections = value == "true" || value == "1" || value == "yes"
+		case "rules":
+			options.Rules = value
+		case "explain":
+			options.Explain = value == "true" || value == "1" || value == "yes"
+		case "speculative_protos_path_prefix":
+			options.SpeculativePathPrefix = value
 		}
 	}
 
 	return options, nil
 }
 
-// processProtoFile extracts C4 objects from a proto file.
-func processProtoFile(file *protogen.File, speculativePathPrefix string) []C4Object {
+// processProtoFile extracts C4 objects from a proto file. IcePanel options on
+// the file and its services take precedence over the classifier.
+func processProtoFile(file *protogen.File, options *Options, classifier *ServiceClassifier) ([]C4Object, error) {
 	objects := make([]C4Object, 0)
 
-	isSpeculative := speculativePathPrefix != "" && strings.HasPrefix(file.Desc.Path(), speculativePathPrefix)
+	prefix := options.SpeculativePathPrefix
+	isSpeculative := prefix != "" && strings.HasPrefix(file.Desc.Path(), prefix)
+
+	fileOpts, err := readOptions(file.Desc.Options(), icepanel.E_File)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IcePanel options in %s: %w", file.Desc.Path(), err)
+	}
 
 	// Process package as system boundary.
 	packageName := string(file.Desc.Package())
 	if packageName != "" {
 		boundary := C4Object{
-			ID:            "boundary-" + packageName,
-			Name:          packageName,
+			ID:            objectID("boundary", file.Desc.Package()),
+			Name:          cmp.Or(fileOpts.DisplayName, packageName),
 			Description:   "Package: " + packageName,
 			Type:          C4SystemBoundary,
+			Technology:    fileOpts.Technology,
 			Package:       packageName,
 			IsSpeculative: isSpeculative,
+			Owner:         fileOpts.OwnerTeam,
+			Tags:          fileOpts.Tags,
+			Links:         fileOpts.Links,
+			FullName:      packageName,
+			File:          file.Desc.Path(),
 		}
 		objects = append(objects, boundary)
 	}
@@ -155,68 +270,217 @@ func processProtoFile(file *protogen.File, speculativePathPrefix string) []C4Obj
 		serviceName := string(service.Desc.Name())
 		serviceComment := service.Comments.Leading.String()
 
-		// Determine service type based on naming convention and comments.
-		objectType := determineServiceType(serviceName, serviceComment)
+		serviceOpts, err := readOptions(service.Desc.Options(), icepanel.E_Service)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IcePanel options on %s in %s: %w",
+				service.Desc.FullName(), file.Desc.Path(), err)
+		}
+		opts := fileOpts.inherit(serviceOpts)
+
+		// Determine service type from the options, then the rules, naming convention and comments.
+		cls := classifier.Evaluate(ServiceInfo{
+			Name:    serviceName,
+			Package: packageName,
+			File:    file.Desc.Path(),
+			Comment: string(service.Comments.Leading),
+			Options: opts,
+		})
+		objectType := opts.objectType(cls.Type)
+		reason := cls.Reason
+		switch {
+		case opts.Type != "":
+			reason = "icepanel option type"
+		case objectType != cls.Type:
+			reason += "; icepanel option external"
+		}
 
 		// Create service object.
 		serviceObj := C4Object{
-			ID:            "service-" + serviceName,
-			Name:          serviceName,
+			ID:            serviceID(service),
+			Name:          cmp.Or(opts.DisplayName, serviceName),
 			Description:   serviceComment,
 			Type:          objectType,
+			Technology:    cmp.Or(opts.Technology, cls.Technology),
 			Package:       packageName,
 			IsSpeculative: isSpeculative,
+			Owner:         opts.OwnerTeam,
+			Tags:          mergeTags(opts.Tags, cls.Tags),
+			Links:         opts.Links,
+			Reason:        reason,
+			FullName:      string(service.Desc.FullName()),
+			File:          file.Desc.Path(),
 		}
 		objects = append(objects, serviceObj)
+		if !options.Components {
+			continue
+		}
+
+		// Process methods as components of the service.
+		for _, method := range service.Methods {
+			objects = append(objects, C4Object{
+				ID:            objectID("method", method.Desc.FullName()),
+				Name:          string(method.Desc.Name()),
+				Description:   method.Comments.Leading.String(),
+				Type:          C4Component,
+				Technology:    "gRPC",
+				Package:       packageName,
+				IsSpeculative: isSpeculative,
+				Parent:        serviceObj.ID,
+				FullName:      string(method.Desc.FullName()),
+				File:          file.Desc.Path(),
+				Method: &Method{
+					Request:   string(method.Input.Desc.FullName()),
+					Response:  string(method.Output.Desc.FullName()),
+					Streaming: streamingMode(method.Desc),
+				},
+			})
+		}
 	}
 
-	return objects
+	return objects, nil
 }
 
-// determineServiceType categorizes services based on naming conventions and comments.
-func determineServiceType(serviceName string, comment string) C4ObjectType {
-	return ClassifyService(serviceName, comment)
+// serviceID returns the object ID of a service.
+func serviceID(service *protogen.Service) string {
+	return objectID("service", service.Desc.FullName())
+}
+
+// objectID returns a stable object ID: the kind of object followed by its
+// fully qualified proto name, normalised to IcePanel handle rules. Letters
+// are lower-cased and every character other than a-z, 0-9 and '_' becomes
+// '-', so IDs never contain "--".
+func objectID(kind string, name protoreflect.FullName) string {
+	id := []byte(kind + "-" + strings.ToLower(string(name)))
+	for i, c := range id {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '_' {
+			id[i] = '-'
+		}
+	}
+	return string(id)
+}
+
+// checkIDs merges the package boundaries of packages split across files and
+// reports every pair of distinct proto elements that map to the same object ID.
+func checkIDs(objects []C4Object) ([]C4Object, error) {
+	seen := make(map[string]int, len(objects))
+	out := objects[:0]
+	var errs []error
+	for _, obj := range objects {
+		i, ok := seen[obj.ID]
+		switch {
+		case !ok:
+			seen[obj.ID] = len(out)
+			out = append(out, obj)
+		case out[i].FullName != obj.FullName:
+			errs = append(errs, fmt.Errorf("object ID %q of %s (%s) collides with %s (%s)",
+				obj.ID, obj.FullName, obj.File, out[i].FullName, out[i].File))
+		default:
+			errs = append(errs, mergeBoundary(&out[i], obj))
+		}
+	}
+	return out, errors.Join(errs...)
+}
+
+// mergeBoundary folds another file's boundary of the same package into b.
+// Tags and links are combined; a display name, owner or technology set in
+// both files must agree. The boundary is speculative only if both are.
+func mergeBoundary(b *C4Object, other C4Object) error {
+	var errs []error
+	merge := func(option string, field *string, value, unset string) {
+		switch {
+		case value == unset || value == *field:
+		case *field == unset:
+			*field = value
+		default:
+			errs = append(errs, fmt.Errorf("package %s has conflicting IcePanel option %s: %q, and %q in %s",
+				b.FullName, option, *field, value, other.File))
+		}
+	}
+	merge("display_name", &b.Name, other.Name, b.FullName)
+	merge("owner_team", &b.Owner, other.Owner, "")
+	merge("technology", &b.Technology, other.Technology, "")
+	b.Tags = mergeTags(b.Tags, other.Tags)
+	for _, link := range other.Links {
+		if !slices.Contains(b.Links, link) {
+			b.Links = append(b.Links, link)
+		}
+	}
+	b.IsSpeculative = b.IsSpeculative && other.IsSpeculative
+	return errors.Join(errs...)
+}
+
+// streamingMode returns the Streaming constant for an RPC method.
+func streamingMode(method protoreflect.MethodDescriptor) string {
+	switch client, server := method.IsStreamingClient(), method.IsStreamingServer(); {
+	case client && server:
+		return StreamingBidi
+	case client:
+		return StreamingClient
+	case server:
+		return StreamingServer
+	}
+	return StreamingNone
 }
 
 // generateIcePanelOutput formats objects for IcePanel import.
-func generateIcePanelOutput(objects []C4Object, options *Options) string {
-	// Include metadata in the output
-	output := "{\n"
-
-	// Add config info if provided
-	if options.LandscapeID != "" || options.VersionID != "" {
-		output += "  \"config\": {\n"
-		if options.LandscapeID != "" {
-			output += fmt.Sprintf("    \"landscapeId\": \"%s\",\n", options.LandscapeID)
-		}
-		if options.VersionID != "" {
-			output += fmt.Sprintf("    \"versionId\": \"%s\",\n", options.VersionID)
-		}
-		output += fmt.Sprintf("    \"wipe\": %t\n", options.Wipe)
-		output += "  },\n"
-	}
-
-	// Add objects array
-	output += "  \"objects\": [\n"
-	for i, obj := range objects {
-		output += "    {\n"
-		output += fmt.Sprintf("      \"id\": \"%s\",\n", obj.ID)
-		output += fmt.Sprintf("      \"name\": \"%s\",\n", obj.Name)
-		output += fmt.Sprintf("      \"description\": \"%s\",\n", obj.Description)
-		output += fmt.Sprintf("      \"type\": \"%s\",\n", obj.Type)
-		output += fmt.Sprintf("      \"package\": \"%s\",\n", obj.Package)
-		output += fmt.Sprintf("      \"isSpeculative\": %t\n", obj.IsSpeculative)
-		output += "    }"
-		if i < len(objects)-1 {
-			output += ",\n"
-		} else {
-			output += "\n"
-		}
-	}
-	output += "  ]\n"
-	output += "}\n"
-
-	return output
+func generateIcePanelOutput(objects []C4Object, connections []C4Connection, options *Options) (string, error) {
+	f := &objectsfile.File{
+		GeneratorVersion: generatorVersion(),
+		Config: objectsfile.Config{
+			LandscapeID: options.LandscapeID,
+			VersionID:   options.VersionID,
+			Wipe:        options.Wipe,
+		},
+		Objects: make([]objectsfile.Object, 0, len(objects)),
+	}
+	for _, obj := range objects {
+		o := objectsfile.Object{
+			ID:            obj.ID,
+			Name:          obj.Name,
+			Description:   obj.Description,
+			Type:          string(obj.Type),
+			Technology:    obj.Technology,
+			Package:       obj.Package,
+			IsSpeculative: obj.IsSpeculative,
+			ParentID:      obj.Parent,
+			Owner:         obj.Owner,
+			Tags:          obj.Tags,
+			SourceFile:    obj.File,
+		}
+		for _, link := range obj.Links {
+			o.Links = append(o.Links, objectsfile.Link{Name: link.Name, URL: link.URL})
+		}
+		if obj.Method != nil {
+			o.Method = &objectsfile.Method{
+				Request:   obj.Method.Request,
+				Response:  obj.Method.Response,
+				Streaming: obj.Method.Streaming,
+			}
+		}
+		hash, err := objectHash(o)
+		if err != nil {
+			return "", fmt.Errorf("failed to hash %s: %w", obj.ID, err)
+		}
+		o.SourceHash = hash
+		f.Objects = append(f.Objects, o)
+	}
+	for _, conn := range connections {
+		f.Connections = append(f.Connections, objectsfile.Connection{
+			ID:         conn.ID,
+			FromID:     conn.From,
+			ToID:       conn.To,
+			Label:      conn.Label,
+			Origin:     conn.Origin,
+			Confidence: conn.Confidence,
+			Evidence:   conn.Evidence,
+		})
+	}
+
+	var b strings.Builder
+	if err := objectsfile.Write(&b, f); err != nil {
+		return "", err
+	}
+	return b.String(), nil
 }
 
 // stringPtr creates a pointer to a string.
@@ -2,11 +2,20 @@
 package generator
 
 import (
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
+	"mermaid-icepanel/cmd/protoc-gen-icepanel/objectsfile"
+	"mermaid-icepanel/internal/config"
+
 	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
 )
 
 // TestProcessProtoFile tests the processProtoFile function with real protogen.File instances.
@@ -38,20 +47,23 @@ func TestProcessProtoFile(t *testing.T) {
 			speculativePathPrefix: "",
 			expected: []C4Object{
 				{
-					ID:            "boundary-example.service",
+					ID:            "boundary-example-service",
 					Name:          "example.service",
 					Description:   "Package: example.service",
 					Type:          C4SystemBoundary,
 					Package:       "example.service",
 					IsSpeculative: false,
+					FullName:      "example.service",
 				},
 				{
-					ID:            "service-UserService",
+					ID:            "service-example-service-userservice",
 					Name:          "UserService",
 					Description:   "//// User management service\n",
 					Type:          C4System,
 					Package:       "example.service",
 					IsSpeculative: false,
+					Reason:        "default",
+					FullName:      "example.service.UserService",
 				},
 			},
 		},
@@ -75,28 +87,33 @@ func TestProcessProtoFile(t *testing.T) {
 			speculativePathPrefix: "",
 			expected: []C4Object{
 				{
-					ID:            "boundary-example.multi",
+					ID:            "boundary-example-multi",
 					Name:          "example.multi",
 					Description:   "Package: example.multi",
 					Type:          C4SystemBoundary,
 					Package:       "example.multi",
 					IsSpeculative: false,
+					FullName:      "example.multi",
 				},
 				{
-					ID:            "service-UserService",
+					ID:            "service-example-multi-userservice",
 					Name:          "UserService",
 					Description:   "//// User management service\n",
 					Type:          C4System,
 					Package:       "example.multi",
 					IsSpeculative: false,
+					Reason:        "default",
+					FullName:      "example.multi.UserService",
 				},
 				{
-					ID:            "service-AuthService",
+					ID:            "service-example-multi-authservice",
 					Name:          "AuthService",
 					Description:   "//// Authentication service\n",
 					Type:          C4System,
 					Package:       "example.multi",
 					IsSpeculative: false,
+					Reason:        "default",
+					FullName:      "example.multi.AuthService",
 				},
 			},
 		},
@@ -116,20 +133,23 @@ func TestProcessProtoFile(t *testing.T) {
 			speculativePathPrefix: "tdd/protos/",
 			expected: []C4Object{
 				{
-					ID:            "boundary-tdd.protos.speculative",
+					ID:            "boundary-tdd-protos-speculative",
 					Name:          "tdd.protos.speculative",
 					Description:   "Package: tdd.protos.speculative",
 					Type:          C4SystemBoundary,
 					Package:       "tdd.protos.speculative",
 					IsSpeculative: true,
+					FullName:      "tdd.protos.speculative",
 				},
 				{
-					ID:            "service-SpeculativeService",
+					ID:            "service-tdd-protos-speculative-speculativeservice",
 					Name:          "SpeculativeService",
 					Description:   "//// Speculative service for TDD\n",
 					Type:          C4System,
 					Package:       "tdd.protos.speculative",
 					IsSpeculative: true,
+					Reason:        "default",
+					FullName:      "tdd.protos.speculative.SpeculativeService",
 				},
 			},
 		},
@@ -159,9 +179,16 @@ func TestProcessProtoFile(t *testing.T) {
 			}
 
 			// Process the file
-			result := processProtoFile(file, tt.speculativePathPrefix)
+			result, err := processProtoFile(file, &Options{SpeculativePathPrefix: tt.speculativePathPrefix},
+				NewDefaultClassifier())
+			if err != nil {
+				t.Fatalf("processProtoFile() error = %v", err)
+			}
 
 			// Check that the result matches expectations
+			for i := range tt.expected {
+				tt.expected[i].File = tt.fileName
+			}
 			if !reflect.DeepEqual(result, tt.expected) {
 				t.Errorf("processProtoFile result mismatch\nwant: %+v\ngot:  %+v", tt.expected, result)
 			}
@@ -200,6 +227,10 @@ func (fd *testFileDescriptor) Package() protoreflect.FullName {
 	return fd.pkg
 }
 
+func (fd *testFileDescriptor) Options() protoreflect.ProtoMessage {
+	return nil
+}
+
 // Test implementation of ServiceDescriptor.
 type testServiceDescriptor struct {
 	protoreflect.ServiceDescriptor
@@ -211,11 +242,19 @@ func (sd *testServiceDescriptor) Name() protoreflect.Name {
 	return sd.name
 }
 
+func (sd *testServiceDescriptor) FullName() protoreflect.FullName {
+	return sd.file.Package().Append(sd.name)
+}
+
 func (sd *testServiceDescriptor) Parent() protoreflect.Descriptor {
 	return sd.file
 }
 
-func TestDetermineServiceType(t *testing.T) {
+func (sd *testServiceDescriptor) Options() protoreflect.ProtoMessage {
+	return nil
+}
+
+func TestServiceClassifier_Classify(t *testing.T) {
 	tests := []struct {
 		name     string
 		service  string
@@ -254,13 +293,368 @@ func TestDetermineServiceType(t *testing.T) {
 		},
 	}
 
+	classifier := NewDefaultClassifier()
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := determineServiceType(tt.service, tt.comment)
+			result := classifier.Evaluate(ServiceInfo{Name: tt.service, Comment: tt.comment}).Type
 			if result != tt.expected {
-				t.Errorf("determineServiceType(%s, %s) = %s, want %s",
+				t.Errorf("Evaluate(%s, %s) = %s, want %s",
 					tt.service, tt.comment, result, tt.expected)
 			}
 		})
 	}
 }
+
+func TestNewClassifier(t *testing.T) {
+	c := NewClassifier(config.Classifier{ExternalPatterns: []string{"Gateway"}})
+
+	tests := []struct {
+		service  string
+		expected C4ObjectType
+	}{
+		{"PaymentGateway", C4SystemExt},
+		{"PartnerService", C4System}, // default external patterns are replaced
+		{"UserRepository", C4SystemDb},
+	}
+	for _, tt := range tests {
+		if got := c.Evaluate(ServiceInfo{Name: tt.service}).Type; got != tt.expected {
+			t.Errorf("Evaluate(%s) = %s, want %s", tt.service, got, tt.expected)
+		}
+	}
+}
+
+func TestGenerateIcePanelOutput(t *testing.T) {
+	objects := []C4Object{{
+		ID:          "service-UserService",
+		Name:        "UserService",
+		Description: "// Manages \"users\".\n// Stores avatars under C:\\avatars.\n",
+		Type:        C4System,
+		Package:     "example.service",
+	}}
+	options := &Options{LandscapeID: "lc", Wipe: true}
+
+	content, err := generateIcePanelOutput(objects, nil, options)
+	if err != nil {
+		t.Fatalf("generateIcePanelOutput() error = %v", err)
+	}
+	f, err := objectsfile.Read(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("output does not parse: %v\n%s", err, content)
+	}
+	want := objectsfile.Config{LandscapeID: "lc", Wipe: true}
+	if f.Config != want {
+		t.Errorf("Config = %+v, want %+v", f.Config, want)
+	}
+	if len(f.Objects) != 1 || f.Objects[0].Description != objects[0].Description {
+		t.Errorf("Objects = %+v, want description %q", f.Objects, objects[0].Description)
+	}
+}
+
+// newRequest builds a CodeGeneratorRequest that generates every given file.
+// It panics if the files cannot be encoded.
+func newRequest(params string, files ...*descriptorpb.FileDescriptorProto) *pluginpb.CodeGeneratorRequest {
+	req := &pluginpb.CodeGeneratorRequest{Parameter: proto.String(params)}
+	for _, f := range files {
+		if f.Options == nil {
+			f.Options = &descriptorpb.FileOptions{GoPackage: proto.String("example.com/" + f.GetPackage())}
+		}
+		req.FileToGenerate = append(req.FileToGenerate, f.GetName())
+		req.ProtoFile = append(req.ProtoFile, f)
+	}
+	// Round-trip the request, as protoc sends it, so that options set as
+	// unknown fields are parsed into their extensions.
+	b, err := proto.Marshal(req)
+	if err != nil {
+		panic(err)
+	}
+	req = &pluginpb.CodeGeneratorRequest{}
+	if err := proto.Unmarshal(b, req); err != nil {
+		panic(err)
+	}
+	return req
+}
+
+// generate runs the plugin on req and returns the objects file it writes.
+func generate(t *testing.T, req *pluginpb.CodeGeneratorRequest) *objectsfile.File {
+	t.Helper()
+	resp, err := Generate(req)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if resp.Error != nil {
+		t.Fatalf("Generate() response error = %s", resp.GetError())
+	}
+	if len(resp.File) != 1 {
+		t.Fatalf("Generate() wrote %d files, want 1", len(resp.File))
+	}
+	f, err := objectsfile.Read(strings.NewReader(resp.File[0].GetContent()))
+	if err != nil {
+		t.Fatalf("output does not parse: %v", err)
+	}
+	return f
+}
+
+// mustHash returns the hash the plugin records for o.
+func mustHash(t *testing.T, o objectsfile.Object) string {
+	t.Helper()
+	hash, err := objectHash(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+// ordersProto defines shop.v1.Orders with one method per streaming mode.
+func ordersProto() *descriptorpb.FileDescriptorProto {
+	method := func(name string, client, server bool) *descriptorpb.MethodDescriptorProto {
+		return &descriptorpb.MethodDescriptorProto{
+			Name:            proto.String(name),
+			InputType:       proto.String(".shop.v1." + name + "Request"),
+			OutputType:      proto.String(".shop.v1.Order"),
+			ClientStreaming: proto.Bool(client),
+			ServerStreaming: proto.Bool(server),
+		}
+	}
+	message := func(name string) *descriptorpb.DescriptorProto {
+		return &descriptorpb.DescriptorProto{Name: proto.String(name)}
+	}
+	return &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("shop/v1/orders.proto"),
+		Package: proto.String("shop.v1"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			message("Order"), message("GetRequest"), message("WatchRequest"),
+			message("ImportRequest"), message("SyncRequest"),
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Orders"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				method("Get", false, false),
+				method("Watch", false, true),
+				method("Import", true, false),
+				method("Sync", true, true),
+			},
+		}},
+		SourceCodeInfo: &descriptorpb.SourceCodeInfo{
+			Location: []*descriptorpb.SourceCodeInfo_Location{{
+				Path:            []int32{6, 0, 2, 0}, // service 0, method 0
+				Span:            []int32{10, 2, 40},
+				LeadingComments: proto.String(" Get returns one order.\n"),
+			}},
+		},
+	}
+}
+
+func TestGenerate_Components(t *testing.T) {
+	t.Run("disabled by default", func(t *testing.T) {
+		f := generate(t, newRequest("", ordersProto()))
+		for _, obj := range f.Objects {
+			if obj.Type == string(C4Component) {
+				t.Errorf("unexpected component %+v", obj)
+			}
+		}
+	})
+
+	req := newRequest("components=true", ordersProto())
+	f := generate(t, req)
+	want := []objectsfile.Object{
+		{ID: "method-shop-v1-orders-get", Name: "Get", Description: "// Get returns one order.\n",
+			Method: &objectsfile.Method{Request: "shop.v1.GetRequest", Response: "shop.v1.Order", Streaming: "unary"}},
+		{ID: "method-shop-v1-orders-watch", Name: "Watch",
+			Method: &objectsfile.Method{Request: "shop.v1.WatchRequest", Response: "shop.v1.Order", Streaming: "server"}},
+		{ID: "method-shop-v1-orders-import", Name: "Import",
+			Method: &objectsfile.Method{Request: "shop.v1.ImportRequest", Response: "shop.v1.Order", Streaming: "client"}},
+		{ID: "method-shop-v1-orders-sync", Name: "Sync",
+			Method: &objectsfile.Method{Request: "shop.v1.SyncRequest", Response: "shop.v1.Order", Streaming: "bidi"}},
+	}
+	for i := range want {
+		want[i].Type, want[i].Technology, want[i].Package = "Component", "gRPC", "shop.v1"
+		want[i].ParentID = "service-shop-v1-orders"
+		want[i].SourceFile = "shop/v1/orders.proto"
+		want[i].SourceHash = mustHash(t, want[i])
+	}
+	if len(f.Objects) != 2+len(want) {
+		t.Fatalf("Objects = %+v, want boundary, service and %d components", f.Objects, len(want))
+	}
+	if got := f.Objects[2:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("components = %+v\nwant %+v", got, want)
+	}
+}
+
+func TestObjectID(t *testing.T) {
+	tests := []struct {
+		kind, name, want string
+	}{
+		{"service", "shop.v1.Orders", "service-shop-v1-orders"},
+		{"method", "shop.v1.Orders.GetOrder", "method-shop-v1-orders-getorder"},
+		{"boundary", "internal_tools.v2", "boundary-internal_tools-v2"},
+		{"service", "Health", "service-health"},
+	}
+	for _, tt := range tests {
+		if got := objectID(tt.kind, protoreflect.FullName(tt.name)); got != tt.want {
+			t.Errorf("objectID(%s, %s) = %s, want %s", tt.kind, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGenerate_IDs(t *testing.T) {
+	service := func(file, pkg string, names ...string) *descriptorpb.FileDescriptorProto {
+		f := &descriptorpb.FileDescriptorProto{
+			Name: proto.String(file), Package: proto.String(pkg), Syntax: proto.String("proto3"),
+		}
+		for _, name := range names {
+			f.Service = append(f.Service, &descriptorpb.ServiceDescriptorProto{Name: proto.String(name)})
+		}
+		return f
+	}
+
+	t.Run("same service name in two packages", func(t *testing.T) {
+		f := generate(t, newRequest("",
+			service("shop/v1/health.proto", "shop.v1", "HealthService"),
+			service("billing/v1/health.proto", "billing.v1", "HealthService"),
+		))
+		var ids []string
+		for _, obj := range f.Objects {
+			ids = append(ids, obj.ID)
+		}
+		want := []string{
+			"boundary-shop-v1", "service-shop-v1-healthservice",
+			"boundary-billing-v1", "service-billing-v1-healthservice",
+		}
+		if !reflect.DeepEqual(ids, want) {
+			t.Errorf("IDs = %v, want %v", ids, want)
+		}
+	})
+
+	t.Run("package split across files", func(t *testing.T) {
+		f := generate(t, newRequest("",
+			service("shop/v1/orders.proto", "shop.v1", "Orders"),
+			service("shop/v1/carts.proto", "shop.v1", "Carts"),
+		))
+		if len(f.Objects) != 3 || f.Objects[0].ID != "boundary-shop-v1" {
+			t.Errorf("Objects = %+v, want one boundary and two services", f.Objects)
+		}
+	})
+
+	t.Run("collision", func(t *testing.T) {
+		resp, err := Generate(newRequest("",
+			service("shop/v1/orders.proto", "shop.v1", "Orders"),
+			service("shop/v1/legacy.proto", "shop.v1", "ORDERS"),
+		))
+		if err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+		want := `object ID "service-shop-v1-orders" of shop.v1.ORDERS (shop/v1/legacy.proto) ` +
+			`collides with shop.v1.Orders (shop/v1/orders.proto)`
+		if !strings.Contains(resp.GetError(), want) || len(resp.File) != 0 {
+			t.Errorf("Generate() response error = %q with %d files, want %q", resp.GetError(), len(resp.File), want)
+		}
+	})
+}
+
+func TestGenerate_SplitPackageOptions(t *testing.T) {
+	withOptions := func(file string, opts *ObjectOptions) *descriptorpb.FileDescriptorProto {
+		f := &descriptorpb.FileDescriptorProto{
+			Name: proto.String(file), Package: proto.String("shop.v1"), Syntax: proto.String("proto3"),
+			Options: &descriptorpb.FileOptions{GoPackage: proto.String("example.com/shop/v1")},
+		}
+		f.Options.ProtoReflect().SetUnknown(encodeOptions(opts, 0))
+		return f
+	}
+
+	t.Run("merged", func(t *testing.T) {
+		f := generate(t, newRequest("",
+			withOptions("shop/v1/orders.proto", &ObjectOptions{OwnerTeam: "shop", Tags: []string{"core"}}),
+			withOptions("shop/v1/carts.proto", &ObjectOptions{
+				DisplayName: "Shop", Tags: []string{"core", "web"},
+				Links: []Link{{Name: "Docs", URL: "https://docs.example.com/shop"}},
+			}),
+		))
+		if len(f.Objects) != 1 {
+			t.Fatalf("Objects = %+v, want one boundary", f.Objects)
+		}
+		b := f.Objects[0]
+		want := []objectsfile.Link{{Name: "Docs", URL: "https://docs.example.com/shop"}}
+		if b.Name != "Shop" || b.Owner != "shop" || !reflect.DeepEqual(b.Tags, []string{"core", "web"}) ||
+			!reflect.DeepEqual(b.Links, want) {
+			t.Errorf("boundary = %+v, want the options of both files", b)
+		}
+	})
+
+	t.Run("conflicting", func(t *testing.T) {
+		resp, err := Generate(newRequest("",
+			withOptions("shop/v1/orders.proto", &ObjectOptions{OwnerTeam: "shop"}),
+			withOptions("shop/v1/carts.proto", &ObjectOptions{OwnerTeam: "carts"}),
+		))
+		if err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+		want := `package shop.v1 has conflicting IcePanel option owner_team: "shop", and "carts" in shop/v1/carts.proto`
+		if resp.GetError() != want {
+			t.Errorf("Generate() response error = %q, want %q", resp.GetError(), want)
+		}
+	})
+}
+
+func TestGenerate_Provenance(t *testing.T) {
+	t.Cleanup(func() { Version = "" })
+	Version = "v1.2.3"
+
+	req := newRequest("speculative_protos_path_prefix=tdd/", ordersProto())
+	f := generate(t, req)
+	if f.GeneratorVersion != "v1.2.3" {
+		t.Errorf("GeneratorVersion = %q, want v1.2.3", f.GeneratorVersion)
+	}
+	for _, obj := range f.Objects {
+		if obj.SourceFile != "shop/v1/orders.proto" || !strings.HasPrefix(obj.SourceHash, "sha256:") ||
+			obj.IsSpeculative {
+			t.Errorf("object %s: source %q, hash %q, speculative %v",
+				obj.ID, obj.SourceFile, obj.SourceHash, obj.IsSpeculative)
+		}
+	}
+
+	unrelated := ordersProto()
+	unrelated.MessageType = append(unrelated.MessageType, &descriptorpb.DescriptorProto{Name: proto.String("Unused")})
+	for i, obj := range generate(t, newRequest("speculative_protos_path_prefix=tdd/", unrelated)).Objects {
+		if obj.SourceHash != f.Objects[i].SourceHash {
+			t.Errorf("SourceHash of %s changed with an unrelated edit", obj.ID)
+		}
+	}
+
+	changed := ordersProto()
+	changed.Name = proto.String("tdd/shop/v1/orders.proto")
+	changed.Service[0].Name = proto.String("NewOrders")
+	g := generate(t, newRequest("speculative_protos_path_prefix=tdd/", changed))
+	if !g.Objects[0].IsSpeculative || g.Objects[0].SourceFile != "tdd/shop/v1/orders.proto" {
+		t.Errorf("object = %+v, want speculative from tdd/shop/v1/orders.proto", g.Objects[0])
+	}
+	if g.Objects[0].SourceHash == f.Objects[0].SourceHash {
+		t.Errorf("SourceHash %s did not change with the object", g.Objects[0].SourceHash)
+	}
+}
+
+func TestGenerate_Profile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	cfg := "default_profile: shop\nprofiles:\n  shop:\n    classifier:\n      external_patterns: [Orders]\n"
+	if err := os.WriteFile(path, []byte(cfg), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ICEPANEL_CONFIG", path)
+	t.Setenv("ICEPANEL_PROFILE", "shop")
+
+	typeOf := func(f *objectsfile.File) string {
+		for _, obj := range f.Objects {
+			if obj.ID == "service-shop-v1-orders" {
+				return obj.Type
+			}
+		}
+		t.Fatalf("Objects = %+v, want service-shop-v1-orders", f.Objects)
+		return ""
+	}
+	if got := typeOf(generate(t, newRequest("", ordersProto()))); got != "System" {
+		t.Errorf("without profile=, type = %q, want System", got)
+	}
+	if got := typeOf(generate(t, newRequest("profile=shop", ordersProto()))); got != "System_Ext" {
+		t.Errorf("with profile=shop, type = %q, want System_Ext", got)
+	}
+}
@@ -0,0 +1,122 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"mermaid-icepanel/proto/icepanel"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// c4Types maps the icepanel.C4Type enum to object types.
+var c4Types = map[icepanel.C4Type]C4ObjectType{
+	icepanel.C4Type_C4_TYPE_UNSPECIFIED: "",
+	icepanel.C4Type_SYSTEM:              C4System,
+	icepanel.C4Type_SYSTEM_EXT:          C4SystemExt,
+	icepanel.C4Type_SYSTEM_DB:           C4SystemDb,
+}
+
+// ObjectOptions holds the icepanel.ObjectOptions of a file or service.
+type ObjectOptions struct {
+	Type        C4ObjectType // empty when unspecified
+	Technology  string
+	OwnerTeam   string
+	Tags        []string
+	External    *bool // nil when unspecified
+	DisplayName string
+	Links       []Link
+}
+
+// Link is a named URL shown on an object.
+type Link struct {
+	Name string
+	URL  string
+}
+
+// readOptions returns the IcePanel options set by ext, icepanel.E_File or
+// icepanel.E_Service, on descriptor options such as *descriptorpb.ServiceOptions.
+// It returns empty options if none are set.
+func readOptions(opts proto.Message, ext protoreflect.ExtensionType) (*ObjectOptions, error) {
+	o := &ObjectOptions{}
+	if opts == nil || !opts.ProtoReflect().IsValid() || !proto.HasExtension(opts, ext) {
+		return o, nil
+	}
+	pb, ok := proto.GetExtension(opts, ext).(*icepanel.ObjectOptions)
+	if !ok {
+		return nil, fmt.Errorf("extension %s is not icepanel.ObjectOptions", ext.TypeDescriptor().FullName())
+	}
+
+	t, ok := c4Types[pb.GetType()]
+	if !ok {
+		return nil, fmt.Errorf("unknown icepanel.C4Type %d", pb.GetType())
+	}
+	o.Type = t
+	o.Technology = pb.GetTechnology()
+	o.OwnerTeam = pb.GetOwnerTeam()
+	o.Tags = pb.GetTags()
+	if pb.External != nil {
+		external := pb.GetExternal()
+		o.External = &external
+	}
+	o.DisplayName = pb.GetDisplayName()
+	for _, link := range pb.GetLinks() {
+		if link.GetUrl() == "" {
+			return nil, errors.New("icepanel.Link without a url")
+		}
+		o.Links = append(o.Links, Link{Name: link.GetName(), URL: link.GetUrl()})
+	}
+	return o, nil
+}
+
+// inherit returns the options of a service in a file with options o. The
+// service's options win; tags and links are added to the file's, and the
+// file's display name is not inherited.
+func (o *ObjectOptions) inherit(service *ObjectOptions) *ObjectOptions {
+	out := *service
+	if out.Type == "" {
+		out.Type = o.Type
+	}
+	if out.Technology == "" {
+		out.Technology = o.Technology
+	}
+	if out.OwnerTeam == "" {
+		out.OwnerTeam = o.OwnerTeam
+	}
+	if out.External == nil {
+		out.External = o.External
+	}
+	out.Tags = mergeTags(o.Tags, service.Tags)
+	out.Links = slices.Concat(o.Links, service.Links)
+	return &out
+}
+
+// objectType returns the type set by the options, or the classified type if
+// none is set, adjusted by the external flag.
+func (o *ObjectOptions) objectType(classified C4ObjectType) C4ObjectType {
+	t := classified
+	if o.Type != "" {
+		t = o.Type
+	}
+	switch {
+	case o.External == nil:
+	case *o.External && t == C4System:
+		t = C4SystemExt
+	case !*o.External && t == C4SystemExt:
+		t = C4System
+	}
+	return t
+}
+
+// mergeTags returns the tags of both lists in order, without duplicates.
+func mergeTags(a, b []string) []string {
+	var tags []string
+	for _, tag := range slices.Concat(a, b) {
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
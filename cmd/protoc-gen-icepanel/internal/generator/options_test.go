@@ -0,0 +1,119 @@
+package generator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"mermaid-icepanel/cmd/protoc-gen-icepanel/objectsfile"
+	"mermaid-icepanel/proto/icepanel"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// encodeOptions encodes o as the icepanel.file or icepanel.service
+// extension, the way protoc passes it to the plugin.
+func encodeOptions(o *ObjectOptions, c4Type icepanel.C4Type) []byte {
+	pb := &icepanel.ObjectOptions{
+		Type:        c4Type,
+		Technology:  o.Technology,
+		OwnerTeam:   o.OwnerTeam,
+		Tags:        o.Tags,
+		External:    o.External,
+		DisplayName: o.DisplayName,
+	}
+	for _, link := range o.Links {
+		pb.Links = append(pb.Links, &icepanel.Link{Name: link.Name, Url: link.URL})
+	}
+	// Both extensions have the same field number, so the encoding suits either.
+	opts := &descriptorpb.FileOptions{}
+	proto.SetExtension(opts, icepanel.E_File, pb)
+	b, err := proto.Marshal(opts)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// paymentsProto defines two services whose names the heuristics misclassify.
+func paymentsProto(fileOpts, providerOpts, ledgerOpts []byte) *descriptorpb.FileDescriptorProto {
+	f := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("payments/v1/payments.proto"),
+		Package: proto.String("payments.v1"),
+		Syntax:  proto.String("proto3"),
+		Options: &descriptorpb.FileOptions{GoPackage: proto.String("example.com/payments/v1")},
+		Service: []*descriptorpb.ServiceDescriptorProto{
+			{Name: proto.String("PaymentProviderService"), Options: &descriptorpb.ServiceOptions{}},
+			{Name: proto.String("LedgerService"), Options: &descriptorpb.ServiceOptions{}},
+		},
+	}
+	f.Options.ProtoReflect().SetUnknown(fileOpts)
+	f.Service[0].Options.ProtoReflect().SetUnknown(providerOpts)
+	f.Service[1].Options.ProtoReflect().SetUnknown(ledgerOpts)
+	return f
+}
+
+func TestGenerate_Options(t *testing.T) {
+	internal, external := false, true
+	runbook := Link{Name: "Runbook", URL: "https://wiki.example.com/payments"}
+
+	t.Run("heuristics without options", func(t *testing.T) {
+		f := generate(t, newRequest("", paymentsProto(nil, nil, nil)))
+		if got := f.Objects[1].Type; got != string(C4SystemExt) {
+			t.Errorf("PaymentProviderService type = %s, want the heuristic %s", got, C4SystemExt)
+		}
+	})
+
+	fileOpts := encodeOptions(&ObjectOptions{OwnerTeam: "payments", Tags: []string{"pci"},
+		DisplayName: "Payments", Technology: "Go"}, 0)
+	providerOpts := encodeOptions(&ObjectOptions{External: &internal, DisplayName: "Payment provider",
+		Tags: []string{"core", "pci"}, Links: []Link{runbook}}, 0)
+	ledgerOpts := encodeOptions(&ObjectOptions{OwnerTeam: "finance", Technology: "Go, Postgres",
+		External: &external}, 1) // SYSTEM
+
+	req := newRequest("", paymentsProto(fileOpts, providerOpts, ledgerOpts))
+	f := generate(t, req)
+	want := []objectsfile.Object{
+		{ID: "boundary-payments-v1", Name: "Payments", Description: "Package: payments.v1",
+			Type: string(C4SystemBoundary), Technology: "Go", Package: "payments.v1",
+			Owner: "payments", Tags: []string{"pci"}},
+		{ID: "service-payments-v1-paymentproviderservice", Name: "Payment provider", Type: string(C4System),
+			Technology: "Go", Package: "payments.v1", Owner: "payments", Tags: []string{"pci", "core"},
+			Links: []objectsfile.Link{{Name: runbook.Name, URL: runbook.URL}}},
+		{ID: "service-payments-v1-ledgerservice", Name: "LedgerService", Type: string(C4SystemExt),
+			Technology: "Go, Postgres", Package: "payments.v1", Owner: "finance", Tags: []string{"pci"}},
+	}
+	for i := range want {
+		want[i].SourceFile = "payments/v1/payments.proto"
+		want[i].SourceHash = mustHash(t, want[i])
+	}
+	if !reflect.DeepEqual(f.Objects, want) {
+		t.Errorf("Objects = %+v\nwant %+v", f.Objects, want)
+	}
+}
+
+func TestGenerate_InvalidOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []byte
+		wantErr string
+	}{
+		{name: "unknown type", opts: encodeOptions(&ObjectOptions{}, 9), wantErr: "unknown icepanel.C4Type 9"},
+		{name: "link without url", opts: encodeOptions(&ObjectOptions{Links: []Link{{Name: "Docs"}}}, 0),
+			wantErr: "without a url"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := Generate(newRequest("", paymentsProto(nil, tt.opts, nil)))
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			if msg := resp.GetError(); !strings.Contains(msg, tt.wantErr) ||
+				!strings.Contains(msg, "payments.v1.PaymentProviderService") {
+				t.Errorf("Generate() response error = %q, want %q naming the service", msg, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"runtime/debug"
+
+	"mermaid-icepanel/cmd/protoc-gen-icepanel/objectsfile"
+)
+
+// Version is the generator version recorded in the objects file. Release
+// builds set it with -ldflags "-X <package path>.Version=v1.2.3"; otherwise
+// the module version from the build info is used.
+var Version string
+
+// generatorVersion returns Version, falling back to the build info.
+func generatorVersion() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// objectHash returns the SHA-256 of an object's fields other than its hash,
+// which changes only when the object does, not with unrelated edits to the
+// rest of its proto file.
+func objectHash(o objectsfile.Object) (string, error) {
+	o.SourceHash = ""
+	b, err := json.Marshal(o)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
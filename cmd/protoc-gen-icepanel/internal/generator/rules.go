@@ -0,0 +1,192 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RuleFile is a classification rule file, passed with the rules= plugin
+// parameter.
+//
+//	rules:
+//	  - name: payment providers are ours
+//	    priority: 10
+//	    match:
+//	      service: Provider
+//	      package: ^payments\.
+//	    type: System
+//	    tags: [payments]
+//	  - name: vendored APIs
+//	    match:
+//	      file: ^third_party/
+//	      option: {owner_team: ^$}
+//	    type: System_Ext
+type RuleFile struct {
+	Rules []*Rule `yaml:"rules"`
+}
+
+// Rule classifies the services it matches. Every pattern in Match must
+// match; a rule without patterns matches every service.
+type Rule struct {
+	Name       string       `yaml:"name"`
+	Priority   int          `yaml:"priority"` // higher priorities are tried first; ties keep file order
+	Match      RuleMatch    `yaml:"match"`
+	Type       C4ObjectType `yaml:"type"` // empty leaves the type to the naming heuristics
+	Tags       []string     `yaml:"tags"`
+	Technology string       `yaml:"technology"`
+
+	source   string // file and position, for explain output
+	patterns []rulePattern
+}
+
+// RuleMatch holds the regular expressions a rule matches services with.
+type RuleMatch struct {
+	Service string            `yaml:"service"`
+	Package string            `yaml:"package"`
+	File    string            `yaml:"file"`
+	Comment string            `yaml:"comment"`
+	Option  map[string]string `yaml:"option"` // IcePanel option name to pattern
+}
+
+type rulePattern struct {
+	field string
+	re    *regexp.Regexp
+}
+
+// ServiceInfo describes a service for rule matching.
+type ServiceInfo struct {
+	Name    string
+	Package string
+	File    string
+	Comment string
+	Options *ObjectOptions
+}
+
+// ruleOptions are the option names rules can match, with their values.
+var ruleOptions = map[string]func(o *ObjectOptions) []string{
+	"type":         func(o *ObjectOptions) []string { return []string{string(o.Type)} },
+	"technology":   func(o *ObjectOptions) []string { return []string{o.Technology} },
+	"owner_team":   func(o *ObjectOptions) []string { return []string{o.OwnerTeam} },
+	"display_name": func(o *ObjectOptions) []string { return []string{o.DisplayName} },
+	"tags":         func(o *ObjectOptions) []string { return o.Tags },
+	"external": func(o *ObjectOptions) []string {
+		if o.External == nil {
+			return []string{""}
+		}
+		return []string{strconv.FormatBool(*o.External)}
+	},
+}
+
+// LoadRules reads a rule file and returns its rules in the order they are
+// tried. Every invalid rule is reported.
+func LoadRules(path string) ([]*Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rule file: %w", err)
+	}
+	var f RuleFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse rule file %s: %w", path, err)
+	}
+
+	var errs []error
+	for i, r := range f.Rules {
+		if r == nil {
+			r = &Rule{}
+			f.Rules[i] = r
+		}
+		r.source = fmt.Sprintf("%s rule %d", path, i+1)
+		if err := r.compile(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.source, err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	slices.SortStableFunc(f.Rules, func(a, b *Rule) int { return b.Priority - a.Priority })
+	return f.Rules, nil
+}
+
+// compile validates the rule and compiles its patterns.
+func (r *Rule) compile() error {
+	var errs []error
+	switch r.Type {
+	case "", C4System, C4SystemExt, C4SystemDb:
+	default:
+		errs = append(errs, fmt.Errorf("invalid type %q: want %s, %s or %s", r.Type, C4System, C4SystemExt, C4SystemDb))
+	}
+	if r.Type == "" && len(r.Tags) == 0 && r.Technology == "" {
+		errs = append(errs, errors.New("rule sets none of type, tags and technology"))
+	}
+
+	add := func(field, pattern string) {
+		if pattern == "" {
+			return
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s pattern: %w", field, err))
+			return
+		}
+		r.patterns = append(r.patterns, rulePattern{field: field, re: re})
+	}
+	add("service", r.Match.Service)
+	add("package", r.Match.Package)
+	add("file", r.Match.File)
+	add("comment", r.Match.Comment)
+	names := make([]string, 0, len(r.Match.Option))
+	for name := range r.Match.Option {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if _, ok := ruleOptions[name]; !ok {
+			errs = append(errs, fmt.Errorf("unknown option %q", name))
+			continue
+		}
+		add("option "+name, r.Match.Option[name])
+	}
+	return errors.Join(errs...)
+}
+
+// Matches reports whether every pattern of the rule matches svc.
+func (r *Rule) Matches(svc ServiceInfo) bool {
+	for _, p := range r.patterns {
+		var values []string
+		switch p.field {
+		case "service":
+			values = []string{svc.Name}
+		case "package":
+			values = []string{svc.Package}
+		case "file":
+			values = []string{svc.File}
+		case "comment":
+			values = []string{svc.Comment}
+		default:
+			opts := svc.Options
+			if opts == nil {
+				opts = &ObjectOptions{}
+			}
+			values = ruleOptions[strings.TrimPrefix(p.field, "option ")](opts)
+		}
+		if !slices.ContainsFunc(values, p.re.MatchString) {
+			return false
+		}
+	}
+	return true
+}
+
+// String describes the rule for explain output.
+func (r *Rule) String() string {
+	if r.Name == "" {
+		return r.source
+	}
+	return fmt.Sprintf("%q (%s)", r.Name, r.source)
+}
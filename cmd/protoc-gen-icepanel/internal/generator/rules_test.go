@@ -0,0 +1,135 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testRules = `
+rules:
+  - name: vendored
+    match: {file: ^third_party/}
+    type: System_Ext
+  - name: payment providers are ours
+    priority: 10
+    match: {service: Provider, package: ^payments\.}
+    type: System
+    tags: [payments]
+    technology: Go
+  - name: finance-owned
+    match:
+      option: {owner_team: ^finance$}
+    tags: [finance]
+`
+
+// writeRules writes a rule file and returns its path.
+func writeRules(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestServiceClassifier_Evaluate(t *testing.T) {
+	path := writeRules(t, testRules)
+	rules, err := LoadRules(path)
+	if err != nil {
+		t.Fatalf("LoadRules() error = %v", err)
+	}
+	c := NewDefaultClassifier()
+	c.Rules = rules
+
+	tests := []struct {
+		name string
+		svc  ServiceInfo
+		want Classification
+	}{
+		{
+			name: "priority wins over file order",
+			svc:  ServiceInfo{Name: "PaymentProviderService", Package: "payments.v1", File: "third_party/pay.proto"},
+			want: Classification{Type: C4System, Tags: []string{"payments"}, Technology: "Go",
+				Reason: `rule "payment providers are ours" (` + path + ` rule 2)`},
+		},
+		{
+			name: "first match in file order",
+			svc:  ServiceInfo{Name: "PaymentProviderService", Package: "shop.v1", File: "third_party/pay.proto"},
+			want: Classification{Type: C4SystemExt, Reason: `rule "vendored" (` + path + ` rule 1)`},
+		},
+		{
+			name: "rule without type keeps the heuristic type",
+			svc: ServiceInfo{Name: "LedgerDBService", Package: "finance.v1", File: "finance.proto",
+				Options: &ObjectOptions{OwnerTeam: "finance"}},
+			want: Classification{Type: C4SystemDb, Tags: []string{"finance"},
+				Reason: `name contains "DB"; rule "finance-owned" (` + path + ` rule 3)`},
+		},
+		{
+			name: "no match",
+			svc:  ServiceInfo{Name: "Orders", Package: "shop.v1", Comment: " Wraps a third-party API.\n"},
+			want: Classification{Type: C4SystemExt, Reason: `comment mentions "third-party"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.Evaluate(tt.svc); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Evaluate() = %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRules_Errors(t *testing.T) {
+	path := writeRules(t, `
+rules:
+  - match: {service: "("}
+    type: System
+  - match: {service: Foo}
+    type: Container
+  - match: {option: {colour: red}}
+    tags: [x]
+  - match: {service: Bar}
+`)
+	_, err := LoadRules(path)
+	if err == nil {
+		t.Fatal("LoadRules() error = nil, want invalid rules")
+	}
+	for _, want := range []string{
+		"rule 1: invalid service pattern",
+		`rule 2: invalid type "Container"`,
+		`rule 3: unknown option "colour"`,
+		"rule 4: rule sets none of type, tags and technology",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("LoadRules() error = %v\nwant it to contain %q", err, want)
+		}
+	}
+
+	if _, err := LoadRules(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("LoadRules(missing) error = nil")
+	}
+}
+
+func TestGenerate_RulesAndExplain(t *testing.T) {
+	path := writeRules(t, testRules)
+	ledgerOpts := encodeOptions(&ObjectOptions{OwnerTeam: "finance"}, 0)
+	req := newRequest("rules="+path+",explain=true", paymentsProto(nil, nil, ledgerOpts))
+
+	resp, err := Generate(req)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if len(resp.File) != 2 || resp.File[1].GetName() != ExplainFile {
+		t.Fatalf("Generate() files = %d, want the objects file and %s", len(resp.File), ExplainFile)
+	}
+	want := "SERVICE                             TYPE    REASON\n" +
+		"payments.v1.PaymentProviderService  System  rule \"payment providers are ours\" (" + path + " rule 2)\n" +
+		"payments.v1.LedgerService           System  default; rule \"finance-owned\" (" + path + " rule 3)\n"
+	if got := resp.File[1].GetContent(); got != want {
+		t.Errorf("explain =\n%s\nwant\n%s", got, want)
+	}
+}
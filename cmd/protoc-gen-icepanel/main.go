@@ -20,6 +20,11 @@ import (
 //   - version=<id>: The IcePanel version ID
 //   - wipe=true|false: Whether to wipe existing content before importing
 //   - speculative_protos_path_prefix=DIR: Mark proto files under DIR as speculative (for TDD workflows)
+//   - profile=<name>: Config profile to read classifier patterns from
+//   - components=true|false: Emit each RPC method as a component of its service
+//   - connections=true|false: Emit connections inferred between services
+//   - rules=FILE: Classify services with the rules in FILE before the built-in heuristics
+//   - explain=true|false: Write icepanel_explain.txt, showing how each service was classified
 //
 // Usage:
 //   protoc --icepanel_out=. \
@@ -45,6 +50,11 @@ Plugin options:
   version=<id>                         IcePanel version ID
   wipe=true|false                      Whether to wipe existing content before importing
   speculative_protos_path_prefix=DIR   Mark proto files under DIR as speculative (for TDD workflows)
+  profile=<name>                       Config profile to read classifier patterns from
+  components=true|false                Emit each RPC method as a component of its service
+  connections=true|false               Emit connections inferred between services
+  rules=FILE                           Classify services with the rules in FILE before the built-in heuristics
+  explain=true|false                   Write icepanel_explain.txt, showing how each service was classified
 
 For more information, see the README or run with -h/--help.
 `)
@@ -82,11 +92,12 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Generate code
+	// Generate code; failures are reported to protoc in the response, so
+	// only reading the request and writing the response exit with status 1
 	resp, err := generator.Generate(req)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to generate code: %v\n", err)
-		os.Exit(1)
+		msg := fmt.Sprintf("failed to generate code: %v", err)
+		resp = &pluginpb.CodeGeneratorResponse{Error: &msg}
 	}
 
 	// Marshal response
@@ -0,0 +1,146 @@
+// Package objectsfile defines icepanel_objects.json, the file written by
+// protoc-gen-icepanel and read by the uploader.
+package objectsfile
+
+import (
+	_ "embed" // for Schema
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Name is the name of the file generated by protoc-gen-icepanel.
+const Name = "icepanel_objects.json"
+
+// SchemaVersion is the version of the file format written by Write. It is
+// incremented whenever a change would break existing readers.
+const SchemaVersion = 1
+
+// Schema is the JSON Schema for the file, also published as
+// icepanel_objects.schema.json next to this package.
+//
+//go:embed icepanel_objects.schema.json
+var Schema []byte
+
+// File is the content of an objects file.
+type File struct {
+	SchemaVersion    int          `json:"schemaVersion"`
+	GeneratorVersion string       `json:"generatorVersion,omitempty"` // version of protoc-gen-icepanel
+	Config           Config       `json:"config,omitzero"`
+	Objects          []Object     `json:"objects"`
+	Connections      []Connection `json:"connections,omitempty"`
+}
+
+// Config holds the plugin parameters that tell the uploader where to upload.
+type Config struct {
+	LandscapeID string `json:"landscapeId,omitempty"`
+	VersionID   string `json:"versionId,omitempty"`
+	Wipe        bool   `json:"wipe"`
+}
+
+// Object is a C4 object extracted from a proto file.
+type Object struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	Type          string `json:"type"`
+	Package       string `json:"package"`
+	IsSpeculative bool   `json:"isSpeculative"`
+
+	Technology string  `json:"technology,omitempty"`
+	ParentID   string  `json:"parentId,omitempty"` // ID of the enclosing object, for components
+	Method     *Method `json:"method,omitempty"`   // RPC signature, for components
+
+	// Metadata from the IcePanel proto options.
+	Owner string   `json:"owner,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+	Links []Link   `json:"links,omitempty"`
+
+	// Where the object came from.
+	SourceFile string `json:"sourceFile,omitempty"` // path of the proto file
+	SourceHash string `json:"sourceHash,omitempty"` // hash of the object's other fields, "sha256:<hex>"
+}
+
+// Link is a named URL shown on an object.
+type Link struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// Connection is a candidate connection between two objects, inferred from
+// the proto descriptors.
+type Connection struct {
+	ID         string `json:"id"`
+	FromID     string `json:"fromId"`
+	ToID       string `json:"toId"`
+	Label      string `json:"label"`
+	Origin     string `json:"origin"`     // message-reference or import
+	Confidence string `json:"confidence"` // one of the Confidence constants
+	Evidence   string `json:"evidence"`   // the reference the connection was inferred from
+}
+
+// Confidence levels of an inferred connection, from strongest to weakest.
+const (
+	// ConfidenceHigh is used when a method's request or response message is
+	// defined in the other package.
+	ConfidenceHigh = "high"
+	// ConfidenceMedium is used when a field of a request or response message,
+	// at any depth, has a type defined in the other package.
+	ConfidenceMedium = "medium"
+	// ConfidenceLow is used when the service's file only imports the other package.
+	ConfidenceLow = "low"
+)
+
+// ConfidenceRank orders confidence levels, higher is stronger. It returns 0
+// for an unknown level.
+func ConfidenceRank(confidence string) int {
+	switch confidence {
+	case ConfidenceHigh:
+		return 3
+	case ConfidenceMedium:
+		return 2
+	case ConfidenceLow:
+		return 1
+	}
+	return 0
+}
+
+// Method is the signature of an RPC method emitted as a component.
+type Method struct {
+	Request   string `json:"request"`   // fully qualified request message name
+	Response  string `json:"response"`  // fully qualified response message name
+	Streaming string `json:"streaming"` // unary, client, server or bidi
+}
+
+// Write encodes f as indented JSON, setting its schema version.
+func Write(w io.Writer, f *File) error {
+	out := *f
+	out.SchemaVersion = SchemaVersion
+	if out.Objects == nil {
+		out.Objects = []Object{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(&out); err != nil {
+		return fmt.Errorf("failed to encode objects file: %w", err)
+	}
+	return nil
+}
+
+// Read decodes an objects file. Files without a schema version predate it and
+// are read as version 1; files from a newer generator are rejected.
+func Read(r io.Reader) (*File, error) {
+	var f File
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("failed to parse objects file: %w", err)
+	}
+	if f.SchemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("objects file has schema version %d, but only version %d is supported; "+
+			"upgrade the uploader", f.SchemaVersion, SchemaVersion)
+	}
+	if f.SchemaVersion == 0 {
+		f.SchemaVersion = 1
+	}
+	return &f, nil
+}
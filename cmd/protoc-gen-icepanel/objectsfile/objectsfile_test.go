@@ -0,0 +1,167 @@
+package objectsfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestWriteRead(t *testing.T) {
+	in := &File{
+		Config: Config{LandscapeID: "lc", VersionID: "v1", Wipe: true},
+		Objects: []Object{{
+			ID:          "service-Orders",
+			Name:        "Orders",
+			Description: "// Handles \"orders\" <and> refunds.\n// Paths use C:\\temp\\n.\n",
+			Type:        "System",
+			Package:     "shop.v1",
+			Owner:       "shop-team",
+			Tags:        []string{"pci"},
+			Links:       []Link{{Name: "Runbook", URL: "https://wiki.example.com/orders"}},
+		}},
+		Connections: []Connection{{
+			ID: "conn-a-b", FromID: "a", ToID: "b", Label: "Uses",
+			Origin: "import", Confidence: "low", Evidence: "a.proto imports b.proto",
+		}},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, in); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		t.Fatalf("Write() produced invalid JSON:\n%s", buf.String())
+	}
+
+	out, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	want := *in
+	want.SchemaVersion = SchemaVersion
+	if !reflect.DeepEqual(*out, want) {
+		t.Errorf("Read() = %+v\nwant %+v", *out, want)
+	}
+}
+
+func TestWrite_OmitsEmptyConfig(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, &File{}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if want := "{\n  \"schemaVersion\": 1,\n  \"objects\": []\n}\n"; buf.String() != want {
+		t.Errorf("Write() = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestConfidenceRank(t *testing.T) {
+	ranks := []int{ConfidenceRank(ConfidenceLow), ConfidenceRank(ConfidenceMedium), ConfidenceRank(ConfidenceHigh)}
+	if !sort.IntsAreSorted(ranks) || ranks[0] <= ConfidenceRank("certain") {
+		t.Errorf("ranks of low, medium, high = %v, unknown = %d", ranks, ConfidenceRank("certain"))
+	}
+}
+
+func TestRead_Versions(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{name: "current", input: `{"schemaVersion": 1, "objects": []}`},
+		{name: "unversioned", input: `{"objects": [{"id": "a"}]}`},
+		{name: "newer", input: `{"schemaVersion": 2, "objects": []}`, wantErr: "schema version 2"},
+		{name: "malformed", input: `{"objects": [`, wantErr: "failed to parse objects file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Read(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Read() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if f.SchemaVersion != SchemaVersion {
+				t.Errorf("SchemaVersion = %d, want %d", f.SchemaVersion, SchemaVersion)
+			}
+		})
+	}
+}
+
+// TestSchema checks that the published schema describes the Go types.
+func TestSchema(t *testing.T) {
+	type properties map[string]json.RawMessage
+	type definition struct {
+		Required   []string   `json:"required"`
+		Properties properties `json:"properties"`
+	}
+	var schema struct {
+		Properties struct {
+			SchemaVersion struct {
+				Const int `json:"const"`
+			} `json:"schemaVersion"`
+			Config struct {
+				Properties properties `json:"properties"`
+			} `json:"config"`
+		} `json:"properties"`
+		Defs struct {
+			Object     definition `json:"object"`
+			Method     definition `json:"method"`
+			Connection definition `json:"connection"`
+			Link       definition `json:"link"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(Schema, &schema); err != nil {
+		t.Fatalf("failed to parse schema: %v", err)
+	}
+	if schema.Properties.SchemaVersion.Const != SchemaVersion {
+		t.Errorf("schema version = %d, want %d", schema.Properties.SchemaVersion.Const, SchemaVersion)
+	}
+
+	for _, tt := range []struct {
+		name string
+		typ  reflect.Type
+		def  definition
+	}{
+		{"config", reflect.TypeFor[Config](), definition{Properties: schema.Properties.Config.Properties}},
+		{"object", reflect.TypeFor[Object](), schema.Defs.Object},
+		{"method", reflect.TypeFor[Method](), schema.Defs.Method},
+		{"connection", reflect.TypeFor[Connection](), schema.Defs.Connection},
+		{"link", reflect.TypeFor[Link](), schema.Defs.Link},
+	} {
+		fields, required := jsonFields(tt.typ)
+		var props []string
+		for p := range tt.def.Properties {
+			props = append(props, p)
+		}
+		sort.Strings(props)
+		if !reflect.DeepEqual(props, fields) {
+			t.Errorf("%s schema properties = %v, want %v", tt.name, props, fields)
+		}
+		sort.Strings(tt.def.Required)
+		if tt.name != "config" && !reflect.DeepEqual(tt.def.Required, required) {
+			t.Errorf("%s schema required = %v, want %v", tt.name, tt.def.Required, required)
+		}
+	}
+}
+
+// jsonFields returns the sorted JSON names of the fields of struct type typ,
+// and of those that are always written.
+func jsonFields(typ reflect.Type) (names, required []string) {
+	for i := range typ.NumField() {
+		name, opts, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		names = append(names, name)
+		if opts == "" {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(names)
+	sort.Strings(required)
+	return names, required
+}
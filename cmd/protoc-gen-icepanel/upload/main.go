@@ -4,22 +4,47 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"log"
 	"time"
 
 	"mermaid-icepanel/cmd/protoc-gen-icepanel/uploader"
+	"mermaid-icepanel/internal/config"
 )
 
 func main() {
 	// Parse command-line arguments
 	filePath := flag.String("file", "icepanel_objects.json", "Path to the generated objects file")
-	token := flag.String("token", "", "IcePanel API token (falls back to ICEPANEL_TOKEN env var)")
-	landscapeID := flag.String("landscape", "", "Override landscape ID from the file")
-	versionID := flag.String("version", "", "Override version ID from the file")
+	token := flag.String("token", "", "IcePanel API token (falls back to ICEPANEL_TOKEN env var, then the profile)")
+	landscapeID := flag.String("landscape", "",
+		"Override landscape ID from the file (the profile is used if neither is set)")
+	versionID := flag.String("version", "",
+		"Override version ID from the file (the profile is used if neither is set)")
 	dryRun := flag.Bool("dry-run", false, "Dry run mode (don't actually upload)")
 	verbose := flag.Bool("v", false, "Verbose output")
-	timeout := flag.Int("timeout", 30, "Request timeout in seconds")
+	var timeout, runTimeout time.Duration
+	flag.Func("timeout",
+		"Per-request timeout, in whole seconds or as a duration such as 45s "+
+			"(defaults to ICEPANEL_TIMEOUT_SECONDS, the profile, then 30s)",
+		durationFlag(&timeout))
+	flag.Func("run-timeout",
+		"Timeout for the whole upload, in whole seconds or as a duration such as 15m "+
+			"(defaults to ICEPANEL_RUN_TIMEOUT, the profile, then 10m)",
+		durationFlag(&runTimeout))
+	minConfidence := flag.String("min-confidence", "low",
+		"Weakest inferred connections to create: high, medium or low")
+	upsert := flag.Bool("upsert", false,
+		"Update objects and connections that already exist instead of failing, and print what changed")
+	prune := flag.Bool("prune", false,
+		"Delete objects uploaded by this tool earlier that are no longer in the file (needs -upsert)")
+	prunePackage := flag.String("prune-package", "", "Only prune objects in this package or its subpackages")
+	maxPrune := flag.Int("max-prune", uploader.DefaultMaxPrune, "Refuse to prune more than this many objects")
+	forcePrune := flag.Bool("force-prune", false, "Prune even if more than -max-prune objects would be deleted")
+	speculative := flag.String("speculative", "",
+		"Upload only the speculative objects (only) or only the others (exclude); all by default")
+	sourcePrefix := flag.String("source-prefix", "", "Only upload objects from proto files under this path")
+	profile := flag.String("profile", "", "Config profile (falls back to ICEPANEL_PROFILE, then default_profile)")
 	flag.Parse()
 
 	// Create upload options
@@ -30,10 +55,21 @@ func main() {
 		DryRun:         *dryRun,
 		ForceLandscape: *landscapeID,
 		ForceVersion:   *versionID,
+		Profile:        *profile,
+		Timeout:        timeout,
+		RunTimeout:     runTimeout,
+		MinConfidence:  *minConfidence,
+		Upsert:         *upsert,
+		Prune:          *prune,
+		PrunePackage:   *prunePackage,
+		MaxPrune:       maxPruneOption(*maxPrune),
+		ForcePrune:     *forcePrune,
+		Speculative:    *speculative,
+		SourcePrefix:   *sourcePrefix,
 	}
 
-	// Set up context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*timeout)*time.Second)
+	// Upload applies the request and run timeouts
+	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	// Upload the objects
@@ -53,3 +89,24 @@ func main() {
 		log.Printf("Upload completed successfully")
 	}
 }
+
+// durationFlag returns a flag.Func parser that stores a positive duration in d.
+func durationFlag(d *time.Duration) func(string) error {
+	return func(s string) error {
+		v, err := config.ParseDuration(s)
+		if err != nil || v <= 0 {
+			return errors.New("want whole seconds or a positive duration such as 45s")
+		}
+		*d = v
+		return nil
+	}
+}
+
+// maxPruneOption maps -max-prune to UploadOptions.MaxPrune, where zero means
+// the default: on the command line, 0 refuses to prune at all.
+func maxPruneOption(n int) int {
+	if n <= 0 {
+		return uploader.NoPrune
+	}
+	return n
+}
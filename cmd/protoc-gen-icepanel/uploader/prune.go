@@ -0,0 +1,130 @@
+package uploader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"mermaid-icepanel/cmd/protoc-gen-icepanel/objectsfile"
+	"mermaid-icepanel/internal/api"
+)
+
+// Uploaded objects carry ManagedBy in their managedBy property, so pruning
+// never deletes objects that were created by hand or by another tool.
+const (
+	ManagedByProp = "managedBy"
+	ManagedBy     = "protoc-gen-icepanel"
+)
+
+// DefaultMaxPrune is the most objects a prune deletes unless forced, used
+// when UploadOptions.MaxPrune is zero.
+const DefaultMaxPrune = 10
+
+// NoPrune as UploadOptions.MaxPrune refuses to prune any object unless forced.
+const NoPrune = -1
+
+// pruneClient is the subset of the IcePanel API used for pruning.
+type pruneClient interface {
+	ListObjects(ctx context.Context, lc, ver string) ([]*api.Object, error)
+	ListConnections(ctx context.Context, lc, ver string) ([]*api.Connection, error)
+	DeleteObjects(ctx context.Context, lc, ver string, objs []*api.Object) error
+	DeleteConnections(ctx context.Context, lc, ver string, handles []string) error
+}
+
+// findOrphans returns the managed objects in scope that are not among the
+// desired ones. It refuses to return more than options.MaxPrune objects
+// unless options.ForcePrune is set, so it must run before anything is
+// written for a refusal to leave the version untouched.
+func findOrphans(ctx context.Context, client pruneClient, lc, ver string, desired []objectsfile.Object,
+	options UploadOptions,
+) ([]*api.Object, error) {
+	objs, err := client.ListObjects(ctx, lc, ver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+	wanted := make(map[string]bool, len(desired))
+	for _, o := range desired {
+		wanted[o.ID] = true
+	}
+	var orphans []*api.Object
+	for _, o := range objs {
+		if !wanted[o.Handle] && o.Props[ManagedByProp] == ManagedBy && inScope(o, options) {
+			orphans = append(orphans, o)
+		}
+	}
+
+	limit := options.MaxPrune
+	switch {
+	case limit == 0:
+		limit = DefaultMaxPrune
+	case limit < 0:
+		limit = 0
+	}
+	if len(orphans) > limit && !options.ForcePrune {
+		return nil, fmt.Errorf("refusing to prune %d objects, more than the limit of %d "+
+			"(raise -max-prune or pass -force-prune)", len(orphans), limit)
+	}
+	return orphans, nil
+}
+
+// prune deletes the orphans found by findOrphans, together with their
+// connections. The deleted objects are written to w; in a dry run nothing
+// is deleted.
+func prune(ctx context.Context, client pruneClient, lc, ver string, orphans []*api.Object, dryRun bool,
+	w io.Writer,
+) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, o := range orphans {
+		if _, err := fmt.Fprintf(tw, "deleted\t%s\t%s\n", o.Handle, o.Name); err != nil {
+			return err
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "Pruned: %d objects\n", len(orphans)); err != nil {
+		return err
+	}
+	if dryRun || len(orphans) == 0 {
+		return nil
+	}
+
+	orphaned := make(map[string]bool, len(orphans))
+	for _, o := range orphans {
+		orphaned[o.Handle] = true
+	}
+	conns, err := client.ListConnections(ctx, lc, ver)
+	if err != nil {
+		return fmt.Errorf("failed to list connections: %w", err)
+	}
+	var handles []string
+	for _, c := range conns {
+		if orphaned[c.From] || orphaned[c.To] {
+			handles = append(handles, c.Handle)
+		}
+	}
+	if err := client.DeleteConnections(ctx, lc, ver, handles); err != nil {
+		return fmt.Errorf("failed to delete connections: %w", err)
+	}
+	if err := client.DeleteObjects(ctx, lc, ver, orphans); err != nil {
+		return fmt.Errorf("failed to delete objects: %w", err)
+	}
+	return nil
+}
+
+// inScope reports whether an object belongs to the package to prune, or one
+// of its subpackages, and passes the upload's speculative and source filters.
+func inScope(o *api.Object, options UploadOptions) bool {
+	speculative, _ := o.Props["speculative"].(bool)
+	sourceFile, _ := o.Props["sourceFile"].(string)
+	if !options.matches(speculative, sourceFile) {
+		return false
+	}
+	if options.PrunePackage == "" {
+		return true
+	}
+	p, _ := o.Props["package"].(string)
+	return p == options.PrunePackage || strings.HasPrefix(p, options.PrunePackage+".")
+}
@@ -4,35 +4,26 @@ package uploader
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
+	"mermaid-icepanel/cmd/protoc-gen-icepanel/objectsfile"
 	"mermaid-icepanel/internal/api"
 	"mermaid-icepanel/internal/config"
 )
 
 // ObjectsFile represents the structure of the generated icepanel_objects.json file.
-type ObjectsFile struct {
-	Config struct {
-		LandscapeID string `json:"landscapeId"`
-		VersionID   string `json:"versionId"`
-		Wipe        bool   `json:"wipe"`
-	} `json:"config"`
-	Objects []Object `json:"objects"`
-}
+type ObjectsFile = objectsfile.File
 
 // Object represents an IcePanel object in the objects file.
-type Object struct {
-	ID          string `json:"id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Type        string `json:"type"`
-	Package     string `json:"package"`
-}
+type Object = objectsfile.Object
 
 // UploadOptions contains options for the Upload function.
 type UploadOptions struct {
@@ -42,6 +33,18 @@ type UploadOptions struct {
 	DryRun         bool
 	ForceLandscape string
 	ForceVersion   string
+	Profile        string        // config profile; see config.Load
+	Timeout        time.Duration // overrides the configured request timeout when non-zero
+	RunTimeout     time.Duration // overrides the configured run timeout when non-zero
+	MinConfidence  string        // weakest inferred connections to create: high, medium or low (the default)
+	Upsert         bool          // update existing objects and connections instead of failing on them
+	Prune          bool          // delete managed objects that are no longer in the file; see ManagedBy
+	PrunePackage   string        // only prune objects in this package or its subpackages
+	MaxPrune       int           // most objects to prune; DefaultMaxPrune if zero, none if NoPrune
+	ForcePrune     bool          // prune even if more than MaxPrune objects would be deleted
+	Out            io.Writer     // where the upsert and prune summaries are written; os.Stdout if nil
+	Speculative    string        // "only" uploads just the speculative objects, "exclude" the others
+	SourcePrefix   string        // only upload objects from proto files under this path
 }
 
 // Upload reads the generated objects file and uploads the objects to IcePanel.
@@ -57,31 +60,61 @@ func Upload(ctx context.Context, options UploadOptions) error {
 		}
 	}()
 
-	data, err := io.ReadAll(file)
+	objectsFile, err := objectsfile.Read(file)
+	if err != nil {
+		return err
+	}
+	objects, err := selectObjects(objectsFile.Objects, options)
 	if err != nil {
-		return fmt.Errorf("failed to read objects file: %w", err)
+		return err
+	}
+	connections, err := selectConnections(objectsFile.Connections, objects, options.MinConfidence)
+	if err != nil {
+		return err
+	}
+	// Without upsert, creating the objects that are still in the file fails
+	// on the existing ones long before anything could be pruned
+	if options.Prune && !options.Upsert && !objectsFile.Config.Wipe {
+		return errors.New("-prune requires -upsert unless the objects file wipes the version")
 	}
 
-	var objectsFile ObjectsFile
-	if err := json.Unmarshal(data, &objectsFile); err != nil {
-		return fmt.Errorf("failed to parse objects file: %w", err)
+	cfg, err := config.Load(options.Profile)
+	if err != nil {
+		return err
 	}
 
-	// Override landscape/version if provided
+	// Override landscape/version if provided, and fall back to the environment or profile
 	if options.ForceLandscape != "" {
 		objectsFile.Config.LandscapeID = options.ForceLandscape
 	}
 	if options.ForceVersion != "" {
 		objectsFile.Config.VersionID = options.ForceVersion
 	}
+	if objectsFile.Config.LandscapeID == "" {
+		objectsFile.Config.LandscapeID = cfg.LandscapeID
+	}
+	if objectsFile.Config.VersionID == "" {
+		objectsFile.Config.VersionID = cfg.VersionID
+	}
 
 	// Validate configuration
 	if objectsFile.Config.LandscapeID == "" || objectsFile.Config.VersionID == "" {
 		return fmt.Errorf("missing landscape ID or version ID in configuration")
 	}
 
+	if options.Timeout > 0 {
+		cfg.RequestTimeout = options.Timeout
+	}
+	if options.RunTimeout > 0 {
+		cfg.RunTimeout = options.RunTimeout
+	}
+	if cfg.RunTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.RunTimeout)
+		defer cancel()
+	}
+
 	// Create IcePanel client
-	cfg := config.NewConfig()
 
 	// Use provided token or fall back to config
 	token := options.Token
@@ -89,9 +122,9 @@ func Upload(ctx context.Context, options UploadOptions) error {
 		token = cfg.DefaultToken
 	}
 
-	httpClient := &api.DefaultHTTPClient{
-		Client: getHTTPClient(),
-	}
+	httpClient := api.NewRetryingHTTPClient(&api.DefaultHTTPClient{
+		Client: getHTTPClient(cfg.RequestTimeout),
+	}, cfg.Retry)
 
 	icepanelClient := api.NewIcePanelClient(cfg, httpClient, token)
 
@@ -101,6 +134,16 @@ func Upload(ctx context.Context, options UploadOptions) error {
 		return fmt.Errorf("failed to validate landscape/version: %w", err)
 	}
 
+	// Find what to prune, and enforce the limit, before anything is written;
+	// a wiped version has nothing left to prune
+	lc, ver := objectsFile.Config.LandscapeID, objectsFile.Config.VersionID
+	var orphans []*api.Object
+	if options.Prune && !objectsFile.Config.Wipe {
+		if orphans, err = findOrphans(ctx, icepanelClient, lc, ver, objects, options); err != nil {
+			return fmt.Errorf("failed to prune objects: %w", err)
+		}
+	}
+
 	// Process wipe request if needed
 	if err := handleWipeIfNeeded(ctx, icepanelClient, objectsFile.Config, options); err != nil {
 		return err
@@ -109,44 +152,179 @@ func Upload(ctx context.Context, options UploadOptions) error {
 	// Upload each object
 	if options.Verbose {
 		log.Printf("Uploading %d objects to landscape %s, version %s",
-			len(objectsFile.Objects), objectsFile.Config.LandscapeID, objectsFile.Config.VersionID)
+			len(objects), objectsFile.Config.LandscapeID, objectsFile.Config.VersionID)
 	}
 
-	for _, obj := range objectsFile.Objects {
+	icepanelObjs := make([]*api.Object, 0, len(objects))
+	for _, obj := range objects {
 		// Convert to IcePanel API object format
 		icepanelObj := &api.Object{
 			Handle: obj.ID,
 			Name:   obj.Name,
 			Desc:   obj.Description,
 			Type:   obj.Type,
+			Parent: obj.ParentID,
 			Props: map[string]interface{}{
-				"package": obj.Package,
+				"package":     obj.Package,
+				"speculative": obj.IsSpeculative,
+				ManagedByProp: ManagedBy,
 			},
 		}
+		if obj.SourceFile != "" {
+			icepanelObj.Props["sourceFile"] = obj.SourceFile
+		}
+		if obj.SourceHash != "" {
+			icepanelObj.Props["sourceHash"] = obj.SourceHash
+		}
+		if objectsFile.GeneratorVersion != "" {
+			icepanelObj.Props[generatorVersionProp] = objectsFile.GeneratorVersion
+		}
+		if obj.Technology != "" {
+			icepanelObj.Props["technology"] = obj.Technology
+		}
+		if obj.Owner != "" {
+			icepanelObj.Props["owner"] = obj.Owner
+		}
+		tags := obj.Tags
+		if obj.IsSpeculative && !slices.Contains(tags, SpeculativeTag) {
+			tags = append(slices.Clip(tags), SpeculativeTag)
+		}
+		if len(tags) > 0 {
+			icepanelObj.Props["tags"] = tags
+		}
+		if len(obj.Links) > 0 {
+			icepanelObj.Props["links"] = obj.Links
+		}
+		if obj.Method != nil {
+			icepanelObj.Props["request"] = obj.Method.Request
+			icepanelObj.Props["response"] = obj.Method.Response
+			icepanelObj.Props["streaming"] = obj.Method.Streaming
+		}
+		icepanelObjs = append(icepanelObjs, icepanelObj)
 
-		// Create the object
-		if options.Verbose {
+		if options.Verbose && !options.Upsert {
 			log.Printf("Creating object: %s (%s)", obj.Name, obj.Type)
 		}
+	}
+
+	out := options.Out
+	if out == nil {
+		out = os.Stdout
+	}
+	if options.Upsert {
+		desired := &api.Diagram{Objects: icepanelObjs, Connections: connections}
+		if err := upsert(ctx, icepanelClient, lc, ver, desired, options.DryRun, out); err != nil {
+			return fmt.Errorf("failed to upsert objects: %w", err)
+		}
+	} else if err := createAll(ctx, icepanelClient, lc, ver, icepanelObjs, connections, options); err != nil {
+		return err
+	}
 
-		if !options.DryRun {
-			if err := icepanelClient.CreateObject(ctx, objectsFile.Config.LandscapeID,
-				objectsFile.Config.VersionID, icepanelObj, false); err != nil {
-				return fmt.Errorf("failed to create object %s: %w", obj.ID, err)
+	// Delete the objects this tool uploaded earlier that are gone from the file
+	if options.Prune && !objectsFile.Config.Wipe {
+		if err := prune(ctx, icepanelClient, lc, ver, orphans, options.DryRun, out); err != nil {
+			return fmt.Errorf("failed to prune objects: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// createAll creates the objects, then the connections between them.
+func createAll(ctx context.Context, client *api.IcePanelClient, lc, ver string,
+	objs []*api.Object, connections []*api.Connection, options UploadOptions,
+) error {
+	// Create the objects concurrently
+	if !options.DryRun {
+		if err := client.CreateObjects(ctx, lc, ver, objs); err != nil {
+			if errors.Is(err, api.ErrConflict) {
+				return fmt.Errorf("failed to create objects, some already exist "+
+					"(generate with wipe=true or upload with -upsert): %w", err)
 			}
+			return fmt.Errorf("failed to create objects: %w", err)
 		}
 	}
 
+	// Create the inferred connections once both ends exist
+	if options.Verbose {
+		for _, conn := range connections {
+			log.Printf("Creating connection: %s -> %s", conn.From, conn.To)
+		}
+	}
+	if !options.DryRun && len(connections) > 0 {
+		if err := client.CreateConnections(ctx, lc, ver, connections); err != nil {
+			return fmt.Errorf("failed to create connections: %w", err)
+		}
+	}
 	return nil
 }
 
+// SpeculativeTag is added to the tags of objects from speculative proto files.
+const SpeculativeTag = "speculative"
+
+// selectObjects returns the objects that pass the speculative and source
+// filters of the options.
+func selectObjects(objs []objectsfile.Object, options UploadOptions) ([]objectsfile.Object, error) {
+	switch options.Speculative {
+	case "", "only", "exclude":
+	default:
+		return nil, fmt.Errorf("invalid speculative filter %q: want only or exclude", options.Speculative)
+	}
+	selected := make([]objectsfile.Object, 0, len(objs))
+	for _, obj := range objs {
+		if options.matches(obj.IsSpeculative, obj.SourceFile) {
+			selected = append(selected, obj)
+		}
+	}
+	return selected, nil
+}
+
+// matches reports whether an object from the given source passes the
+// speculative and source filters.
+func (o UploadOptions) matches(speculative bool, sourceFile string) bool {
+	switch {
+	case o.Speculative == "only" && !speculative, o.Speculative == "exclude" && speculative:
+		return false
+	case o.SourcePrefix != "" && !strings.HasPrefix(sourceFile, o.SourcePrefix):
+		return false
+	}
+	return true
+}
+
+// selectConnections converts the connections between the selected objects
+// at or above the minimum confidence to the IcePanel API format.
+func selectConnections(conns []objectsfile.Connection, objs []objectsfile.Object,
+	minConfidence string,
+) ([]*api.Connection, error) {
+	if minConfidence == "" {
+		minConfidence = objectsfile.ConfidenceLow
+	}
+	minRank := objectsfile.ConfidenceRank(minConfidence)
+	if minRank == 0 {
+		return nil, fmt.Errorf("invalid minimum confidence %q: want high, medium or low", minConfidence)
+	}
+	ids := make(map[string]bool, len(objs))
+	for _, obj := range objs {
+		ids[obj.ID] = true
+	}
+	selected := make([]*api.Connection, 0, len(conns))
+	for _, conn := range conns {
+		if objectsfile.ConfidenceRank(conn.Confidence) < minRank || !ids[conn.FromID] || !ids[conn.ToID] {
+			continue
+		}
+		selected = append(selected, &api.Connection{
+			Handle: conn.ID,
+			From:   conn.FromID,
+			To:     conn.ToID,
+			Label:  conn.Label,
+		})
+	}
+	return selected, nil
+}
+
 // handleWipeIfNeeded performs a version wipe if requested.
 func handleWipeIfNeeded(ctx context.Context, client *api.IcePanelClient,
-	config struct {
-		LandscapeID string `json:"landscapeId"`
-		VersionID   string `json:"versionId"`
-		Wipe        bool   `json:"wipe"`
-	},
+	config objectsfile.Config,
 	options UploadOptions,
 ) error {
 	if !config.Wipe {
@@ -170,7 +348,8 @@ func handleWipeIfNeeded(ctx context.Context, client *api.IcePanelClient,
 	return nil
 }
 
-// getHTTPClient returns the HTTP client to use for API requests.
-func getHTTPClient() *http.Client {
-	return http.DefaultClient
+// getHTTPClient returns the HTTP client to use for API requests, with the
+// given per-request timeout.
+func getHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout}
 }
@@ -0,0 +1,402 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mermaid-icepanel/internal/api"
+	"mermaid-icepanel/internal/api/apitest"
+)
+
+const testObjects = `{
+  "config": {"landscapeId": "lc", "versionId": "v1", "wipe": %s},
+  "objects": [
+    {"id": "service-Orders", "name": "Orders", "description": "Order API", "type": "app", "package": "shop.v1"},
+    {"id": "service-Billing", "name": "Billing", "description": "", "type": "app", "package": "shop.v1"}
+  ]
+}`
+
+// setup starts a fake IcePanel API with version lc/v1, points the uploader
+// at it and writes the objects file.
+func setup(t *testing.T, wipe string) (*apitest.Server, string) {
+	t.Helper()
+	srv := apitest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.AddVersion("lc", "v1")
+	t.Setenv("ICEPANEL_API_URL", srv.URL)
+	t.Setenv("ICEPANEL_MAX_RETRIES", "0")
+	t.Setenv("ICEPANEL_CONFIG", filepath.Join(t.TempDir(), "none.yaml"))
+	t.Setenv("ICEPANEL_PROFILE", "")
+
+	path := filepath.Join(t.TempDir(), "icepanel_objects.json")
+	data := []byte(fmt.Sprintf(testObjects, wipe))
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("failed to write objects file: %v", err)
+	}
+	return srv, path
+}
+
+func TestUpload(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("creates objects", func(t *testing.T) {
+		srv, path := setup(t, "false")
+		if err := Upload(ctx, UploadOptions{FilePath: path, Token: "t"}); err != nil {
+			t.Fatalf("Upload() error = %v", err)
+		}
+		objs := srv.Objects("lc", "v1")
+		if len(objs) != 2 || objs[0].Name != "Orders" || objs[0].Props["package"] != "shop.v1" {
+			t.Errorf("objects = %+v", objs)
+		}
+	})
+
+	t.Run("wipes first", func(t *testing.T) {
+		srv, path := setup(t, "true")
+		srv.Seed("lc", "v1", apitest.KindObjects, &api.Object{Handle: "service-Orders", Name: "Old", Type: "app"})
+		if err := Upload(ctx, UploadOptions{FilePath: path, Token: "t"}); err != nil {
+			t.Fatalf("Upload() error = %v", err)
+		}
+		if objs := srv.Objects("lc", "v1"); len(objs) != 2 || objs[0].Name != "Orders" {
+			t.Errorf("objects = %+v", objs)
+		}
+	})
+
+	t.Run("conflict without wipe", func(t *testing.T) {
+		srv, path := setup(t, "false")
+		srv.Seed("lc", "v1", apitest.KindObjects, &api.Object{Handle: "service-Orders", Name: "Old", Type: "app"})
+		err := Upload(ctx, UploadOptions{FilePath: path, Token: "t"})
+		if !errors.Is(err, api.ErrConflict) {
+			t.Errorf("Upload() error = %v, want ErrConflict", err)
+		}
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		srv, path := setup(t, "true")
+		srv.Seed("lc", "v1", apitest.KindObjects, &api.Object{Handle: "keep", Name: "Keep", Type: "app"})
+		if err := Upload(ctx, UploadOptions{FilePath: path, Token: "t", DryRun: true}); err != nil {
+			t.Fatalf("Upload() error = %v", err)
+		}
+		if objs := srv.Objects("lc", "v1"); len(objs) != 1 || objs[0].Handle != "keep" {
+			t.Errorf("dry run changed the version: %+v", objs)
+		}
+	})
+
+	t.Run("landscape and version from profile", func(t *testing.T) {
+		srv, _ := setup(t, "false")
+		dir := t.TempDir()
+		path := filepath.Join(dir, "icepanel_objects.json")
+		data := `{"objects": [{"id": "service-A", "name": "A", "type": "app"}]}`
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		cfgPath := filepath.Join(dir, "config.yaml")
+		t.Setenv("ICEPANEL_CONFIG", cfgPath)
+		cfg := "profiles:\n  shop:\n    api_url: " + srv.URL + "\n    landscape: lc\n    version: v1\n"
+		if err := os.WriteFile(cfgPath, []byte(cfg), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := Upload(ctx, UploadOptions{FilePath: path, Token: "t", Profile: "shop"}); err != nil {
+			t.Fatalf("Upload() error = %v", err)
+		}
+		if n := srv.Count("lc", "v1", apitest.KindObjects); n != 1 {
+			t.Errorf("objects = %d, want 1", n)
+		}
+	})
+
+	t.Run("components under their service", func(t *testing.T) {
+		srv, _ := setup(t, "false")
+		path := filepath.Join(t.TempDir(), "icepanel_objects.json")
+		data := `{"config": {"landscapeId": "lc", "versionId": "v1"}, "objects": [
+		  {"id": "service-Orders", "name": "Orders", "type": "app"},
+		  {"id": "method-Orders-Get", "name": "Get", "type": "component", "technology": "gRPC",
+		   "parentId": "service-Orders",
+		   "method": {"request": "shop.v1.GetRequest", "response": "shop.v1.Order", "streaming": "unary"}}
+		]}`
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := Upload(ctx, UploadOptions{FilePath: path, Token: "t"}); err != nil {
+			t.Fatalf("Upload() error = %v", err)
+		}
+		var get *api.Object
+		for _, obj := range srv.Objects("lc", "v1") {
+			if obj.Handle == "method-Orders-Get" {
+				get = obj
+			}
+		}
+		if get == nil || get.Parent != "service-Orders" || get.Props["technology"] != "gRPC" ||
+			get.Props["request"] != "shop.v1.GetRequest" || get.Props["streaming"] != "unary" {
+			t.Errorf("component = %+v", get)
+		}
+	})
+
+	t.Run("connections at or above the minimum confidence", func(t *testing.T) {
+		srv, _ := setup(t, "false")
+		path := filepath.Join(t.TempDir(), "icepanel_objects.json")
+		data := `{"config": {"landscapeId": "lc", "versionId": "v1"}, "objects": [
+		  {"id": "service-Orders", "name": "Orders", "type": "app"},
+		  {"id": "service-Billing", "name": "Billing", "type": "app"},
+		  {"id": "service-Users", "name": "Users", "type": "app"}
+		], "connections": [
+		  {"id": "c1", "fromId": "service-Orders", "toId": "service-Billing", "label": "Uses",
+		   "origin": "message-reference", "confidence": "high", "evidence": "x"},
+		  {"id": "c2", "fromId": "service-Orders", "toId": "service-Users", "label": "Uses",
+		   "origin": "import", "confidence": "low", "evidence": "y"}
+		]}`
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		err := Upload(ctx, UploadOptions{FilePath: path, Token: "t", MinConfidence: "medium"})
+		if err != nil {
+			t.Fatalf("Upload() error = %v", err)
+		}
+		conns := srv.Connections("lc", "v1")
+		if len(conns) != 1 || conns[0].Handle != "c1" || conns[0].From != "service-Orders" {
+			t.Errorf("connections = %+v, want only c1", conns)
+		}
+
+		err = Upload(ctx, UploadOptions{FilePath: path, Token: "t", MinConfidence: "certain"})
+		if err == nil || !strings.Contains(err.Error(), "invalid minimum confidence") {
+			t.Errorf("Upload() error = %v, want invalid minimum confidence", err)
+		}
+	})
+
+	t.Run("upsert", func(t *testing.T) {
+		srv, path := setup(t, "false")
+		srv.Seed("lc", "v1", apitest.KindObjects,
+			&api.Object{Handle: "service-Orders", Name: "Orders", Desc: "Order API", Type: "app",
+				Props: map[string]interface{}{"package": "shop.v1", "speculative": false, ManagedByProp: ManagedBy}},
+			&api.Object{Handle: "service-Billing", Name: "Billing", Desc: "Old", Type: "app",
+				Props: map[string]interface{}{"package": "shop.v1", "speculative": false, ManagedByProp: ManagedBy}},
+			&api.Object{Handle: "other", Name: "Other", Type: "app"})
+		data := `{
+		  "config": {"landscapeId": "lc", "versionId": "v1"},
+		  "objects": [
+		    {"id": "service-Orders", "name": "Orders", "description": "Order API", "type": "app", "package": "shop.v1"},
+		    {"id": "service-Billing", "name": "Billing", "description": "", "type": "app", "package": "shop.v1"},
+		    {"id": "service-Users", "name": "Users", "description": "", "type": "app", "package": "shop.v1"}
+		  ]}`
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		var out strings.Builder
+		err := Upload(ctx, UploadOptions{FilePath: path, Token: "t", Upsert: true, Out: &out})
+		if err != nil {
+			t.Fatalf("Upload() error = %v", err)
+		}
+		want := "unchanged  service-Orders   Orders\n" +
+			"updated    service-Billing  Billing  (Desc)\n" +
+			"created    service-Users    Users\n" +
+			"Objects: 1 created, 1 updated, 1 unchanged\n"
+		if out.String() != want {
+			t.Errorf("summary =\n%s\nwant\n%s", out.String(), want)
+		}
+		objs := srv.Objects("lc", "v1")
+		if len(objs) != 4 {
+			t.Fatalf("objects = %+v, want 4 with other kept", objs)
+		}
+		for _, obj := range objs {
+			if obj.Handle == "service-Billing" && obj.Desc != "" {
+				t.Errorf("Billing description = %q, want it cleared", obj.Desc)
+			}
+		}
+
+		out.Reset()
+		err = Upload(ctx, UploadOptions{FilePath: path, Token: "t", Upsert: true, Out: &out})
+		if err != nil {
+			t.Fatalf("second Upload() error = %v", err)
+		}
+		if !strings.HasSuffix(out.String(), "Objects: 0 created, 0 updated, 3 unchanged\n") {
+			t.Errorf("second summary =\n%s", out.String())
+		}
+
+		// A new generator version alone does not update anything
+		data = strings.Replace(data, `"config"`, `"generatorVersion": "v9.9.9", "config"`, 1)
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		out.Reset()
+		err = Upload(ctx, UploadOptions{FilePath: path, Token: "t", Upsert: true, Out: &out})
+		if err != nil {
+			t.Fatalf("third Upload() error = %v", err)
+		}
+		if !strings.HasSuffix(out.String(), "Objects: 0 created, 0 updated, 3 unchanged\n") {
+			t.Errorf("summary after a generator upgrade =\n%s", out.String())
+		}
+	})
+
+	t.Run("prune", func(t *testing.T) {
+		managed := func(handle, pkg string) *api.Object {
+			return &api.Object{Handle: handle, Name: handle, Type: "app",
+				Props: map[string]interface{}{"package": pkg, ManagedByProp: ManagedBy}}
+		}
+		srv, path := setup(t, "false")
+		srv.Seed("lc", "v1", apitest.KindObjects,
+			managed("service-Orders", "shop.v1"), managed("service-Billing", "shop.v1"),
+			managed("service-Gone", "shop.v1"), managed("service-Users", "users.v1"),
+			&api.Object{Handle: "manual", Name: "Manual", Type: "app"})
+		srv.Seed("lc", "v1", apitest.KindConnections,
+			&api.Connection{Handle: "c1", From: "service-Orders", To: "service-Gone", Label: "Uses"},
+			&api.Connection{Handle: "c2", From: "service-Orders", To: "manual", Label: "Uses"})
+
+		var out strings.Builder
+		err := Upload(ctx, UploadOptions{FilePath: path, Token: "t", Upsert: true, Prune: true,
+			PrunePackage: "shop", MaxPrune: 1, Out: &out})
+		if err != nil {
+			t.Fatalf("Upload() error = %v", err)
+		}
+		if !strings.HasSuffix(out.String(), "deleted  service-Gone  service-Gone\nPruned: 1 objects\n") {
+			t.Errorf("summary =\n%s", out.String())
+		}
+		var handles []string
+		for _, obj := range srv.Objects("lc", "v1") {
+			handles = append(handles, obj.Handle)
+		}
+		if want := "service-Orders service-Billing service-Users manual"; strings.Join(handles, " ") != want {
+			t.Errorf("objects = %v, want %s", handles, want)
+		}
+		if conns := srv.Connections("lc", "v1"); len(conns) != 1 || conns[0].Handle != "c2" {
+			t.Errorf("connections = %+v, want only c2", conns)
+		}
+
+		// Without the package scope, service-Users is orphaned too
+		err = Upload(ctx, UploadOptions{FilePath: path, Token: "t", Upsert: true, Prune: true,
+			DryRun: true, Out: io.Discard})
+		if err != nil {
+			t.Fatalf("dry run Upload() error = %v", err)
+		}
+		if n := srv.Count("lc", "v1", apitest.KindObjects); n != 4 {
+			t.Errorf("objects = %d after dry run, want 4", n)
+		}
+		srv.Seed("lc", "v1", apitest.KindObjects, managed("service-Gone", "shop.v1"))
+		err = Upload(ctx, UploadOptions{FilePath: path, Token: "t", Upsert: true, Prune: true,
+			MaxPrune: 1, Out: io.Discard})
+		if err == nil || !strings.Contains(err.Error(), "refusing to prune 2 objects") {
+			t.Errorf("Upload() error = %v, want refusal", err)
+		}
+		if n := srv.Count("lc", "v1", apitest.KindObjects); n != 5 {
+			t.Errorf("objects = %d after refusal, want 5", n)
+		}
+		err = Upload(ctx, UploadOptions{FilePath: path, Token: "t", Upsert: true, Prune: true,
+			MaxPrune: 1, ForcePrune: true, Out: io.Discard})
+		if err != nil {
+			t.Fatalf("forced Upload() error = %v", err)
+		}
+		if n := srv.Count("lc", "v1", apitest.KindObjects); n != 3 {
+			t.Errorf("objects = %d after forced prune, want 3", n)
+		}
+	})
+
+	t.Run("prune limit checked before writing", func(t *testing.T) {
+		managed := func(handle string) *api.Object {
+			return &api.Object{Handle: handle, Name: handle, Type: "app",
+				Props: map[string]interface{}{"package": "shop.v1", ManagedByProp: ManagedBy}}
+		}
+		srv, path := setup(t, "false")
+		srv.Seed("lc", "v1", apitest.KindObjects, managed("service-Orders"), managed("service-Gone"))
+
+		for _, limit := range []int{NoPrune, 0} {
+			err := Upload(ctx, UploadOptions{FilePath: path, Token: "t", Upsert: true, Prune: true,
+				MaxPrune: limit, DryRun: limit == 0, Out: io.Discard})
+			if (err != nil) != (limit == NoPrune) {
+				t.Errorf("Upload(MaxPrune: %d) error = %v, want refusal only with NoPrune", limit, err)
+			}
+		}
+		for _, r := range srv.Requests() {
+			if !strings.HasPrefix(r, "GET ") {
+				t.Errorf("request %s after a refused prune, want only reads", r)
+			}
+		}
+		if objs := srv.Objects("lc", "v1"); len(objs) != 2 || objs[0].Name != "service-Orders" {
+			t.Errorf("objects = %+v, want them untouched", objs)
+		}
+	})
+
+	t.Run("prune without upsert", func(t *testing.T) {
+		srv, path := setup(t, "false")
+		err := Upload(ctx, UploadOptions{FilePath: path, Token: "t", Prune: true, Out: io.Discard})
+		if err == nil || !strings.Contains(err.Error(), "-prune requires -upsert") {
+			t.Errorf("Upload() error = %v, want -prune to require -upsert", err)
+		}
+		if reqs := srv.Requests(); len(reqs) != 0 {
+			t.Errorf("requests = %v, want none", reqs)
+		}
+
+		// A wiped version has nothing to prune, so upsert is not needed
+		srv, path = setup(t, "true")
+		if err := Upload(ctx, UploadOptions{FilePath: path, Token: "t", Prune: true, Out: io.Discard}); err != nil {
+			t.Errorf("Upload() with wipe error = %v", err)
+		}
+		if n := srv.Count("lc", "v1", apitest.KindObjects); n != 2 {
+			t.Errorf("objects = %d after a wiped upload, want 2", n)
+		}
+	})
+
+	t.Run("provenance and speculative filter", func(t *testing.T) {
+		srv, _ := setup(t, "false")
+		path := filepath.Join(t.TempDir(), "icepanel_objects.json")
+		data := `{"generatorVersion": "v1.2.3", "config": {"landscapeId": "lc", "versionId": "v1"}, "objects": [
+		  {"id": "service-Orders", "name": "Orders", "type": "app", "package": "shop.v1",
+		   "sourceFile": "shop/v1/orders.proto", "sourceHash": "sha256:aa"},
+		  {"id": "service-Returns", "name": "Returns", "type": "app", "package": "shop.v1", "isSpeculative": true,
+		   "tags": ["draft"], "sourceFile": "tdd/shop/v1/returns.proto", "sourceHash": "sha256:bb"}
+		], "connections": [
+		  {"id": "c1", "fromId": "service-Returns", "toId": "service-Orders", "label": "Uses",
+		   "origin": "import", "confidence": "low", "evidence": "x"}
+		]}`
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		err := Upload(ctx, UploadOptions{FilePath: path, Token: "t", Speculative: "only"})
+		if err != nil {
+			t.Fatalf("Upload() error = %v", err)
+		}
+		objs := srv.Objects("lc", "v1")
+		if len(objs) != 1 || objs[0].Handle != "service-Returns" {
+			t.Fatalf("objects = %+v, want only service-Returns", objs)
+		}
+		want := map[string]interface{}{
+			"package": "shop.v1", "speculative": true, ManagedByProp: ManagedBy,
+			"sourceFile": "tdd/shop/v1/returns.proto", "sourceHash": "sha256:bb", "generatorVersion": "v1.2.3",
+			"tags": []interface{}{"draft", SpeculativeTag},
+		}
+		if !reflect.DeepEqual(objs[0].Props, want) {
+			t.Errorf("props = %v\nwant %v", objs[0].Props, want)
+		}
+		if n := srv.Count("lc", "v1", apitest.KindConnections); n != 0 {
+			t.Errorf("connections = %d, want none to the filtered out service", n)
+		}
+
+		// Pruning the stable objects leaves the speculative one alone
+		err = Upload(ctx, UploadOptions{FilePath: path, Token: "t", Upsert: true, Prune: true,
+			Speculative: "exclude", SourcePrefix: "shop/", Out: io.Discard})
+		if err != nil {
+			t.Fatalf("Upload() error = %v", err)
+		}
+		if n := srv.Count("lc", "v1", apitest.KindObjects); n != 2 {
+			t.Errorf("objects = %d, want 2", n)
+		}
+
+		err = Upload(ctx, UploadOptions{FilePath: path, Token: "t", Speculative: "some"})
+		if err == nil || !strings.Contains(err.Error(), "invalid speculative filter") {
+			t.Errorf("Upload() error = %v, want invalid speculative filter", err)
+		}
+	})
+
+	t.Run("unknown version", func(t *testing.T) {
+		_, path := setup(t, "false")
+		err := Upload(ctx, UploadOptions{FilePath: path, Token: "t", ForceVersion: "missing"})
+		if !errors.Is(err, api.ErrNotFound) {
+			t.Errorf("Upload() error = %v, want ErrNotFound", err)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package uploader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"mermaid-icepanel/internal/api"
+	"mermaid-icepanel/internal/reconcile"
+)
+
+// Outcomes of upserting an object, as printed in the summary.
+const (
+	created   = "created"
+	updated   = "updated"
+	unchanged = "unchanged"
+)
+
+// generatorVersionProp records the version of protoc-gen-icepanel that wrote
+// an object. A change to it alone does not make upsert update the object.
+const generatorVersionProp = "generatorVersion"
+
+// upsert brings the objects and connections of a version in line with the
+// desired ones without deleting anything: missing ones are created, changed
+// ones are updated and the rest are left alone. The outcome for each object
+// is written to w; in a dry run nothing else happens.
+func upsert(ctx context.Context, client reconcile.Client, lc, ver string, desired *api.Diagram,
+	dryRun bool, w io.Writer,
+) error {
+	plan, err := reconcile.Fetch(ctx, client, lc, ver, desired)
+	if err != nil {
+		return err
+	}
+	plan.DeleteObjects, plan.DeleteConnections = nil, nil
+	ignoreGeneratorVersion(plan)
+
+	if err := writeSummary(w, desired.Objects, plan); err != nil {
+		return fmt.Errorf("failed to write upsert summary: %w", err)
+	}
+	if dryRun {
+		return nil
+	}
+	return reconcile.Apply(ctx, client, lc, ver, plan)
+}
+
+// ignoreGeneratorVersion drops the updates that would only record a new
+// generator version, so upgrading the plugin does not touch every object.
+func ignoreGeneratorVersion(plan *reconcile.Plan) {
+	updates := plan.UpdateObjects[:0]
+	for _, u := range plan.UpdateObjects {
+		delete(u.Changes, "Props."+generatorVersionProp)
+		if len(u.Changes) > 0 {
+			updates = append(updates, u)
+		}
+	}
+	plan.UpdateObjects = updates
+}
+
+// writeSummary prints whether each object is created, updated or unchanged,
+// in the order of the objects file, followed by the totals.
+func writeSummary(w io.Writer, objs []*api.Object, plan *reconcile.Plan) error {
+	outcome := make(map[string]string, len(objs))
+	for _, o := range plan.CreateObjects {
+		outcome[o.Handle] = created
+	}
+	changes := make(map[string]string, len(plan.UpdateObjects))
+	for _, u := range plan.UpdateObjects {
+		outcome[u.Desired.Handle] = updated
+		fields := make([]string, 0, len(u.Changes))
+		for f := range u.Changes {
+			fields = append(fields, f)
+		}
+		sort.Strings(fields)
+		changes[u.Desired.Handle] = "\t(" + strings.Join(fields, ", ") + ")"
+	}
+
+	counts := make(map[string]int, 3)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, o := range objs {
+		status := outcome[o.Handle]
+		if status == "" {
+			status = unchanged
+		}
+		counts[status]++
+		if _, err := fmt.Fprintf(tw, "%s\t%s\t%s%s\n", status, o.Handle, o.Name, changes[o.Handle]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "Objects: %d created, %d updated, %d unchanged\n",
+		counts[created], counts[updated], counts[unchanged])
+	return err
+}
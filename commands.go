@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"mermaid-icepanel/internal/api"
+	"mermaid-icepanel/internal/dryrun"
+	"mermaid-icepanel/internal/export"
+	"mermaid-icepanel/internal/reconcile"
+	"mermaid-icepanel/internal/validate"
+)
+
+// runImport uploads a Mermaid diagram as a new IcePanel diagram.
+func runImport(fs *flag.FlagSet, args []string, stdout io.Writer) error {
+	var vf versionFlags
+	var mf mermaidFlags
+	vf.register(fs)
+	mf.register(fs)
+	diagramName := fs.String("name", "Imported diagram", "Diagram name")
+	wipe := fs.Bool("wipe", false, "Delete existing content before import")
+	validateRemote := fs.Bool("validate-remote", false,
+		"Allow relationships to reference objects that already exist in the IcePanel version")
+	dryRun := fs.Bool("dry-run", false,
+		"Print what would be deleted and posted without changing anything; only reads the version with -wipe")
+	jsonOut := fs.Bool("json", false, "With -dry-run, print the report as JSON")
+	if err := vf.parse(fs, args); err != nil {
+		return err
+	}
+	if err := requireFlags(fs, "mmd", "landscape", "version"); err != nil {
+		return err
+	}
+	if *validateRemote && *wipe {
+		fs.Usage()
+		return &requiredFieldError{msg: "-validate-remote cannot be combined with -wipe"}
+	}
+	if *jsonOut && !*dryRun {
+		fs.Usage()
+		return &requiredFieldError{msg: "-json requires -dry-run"}
+	}
+
+	diagram, err := mf.parse()
+	if err != nil {
+		return err
+	}
+
+	// A dry run only talks to IcePanel when it needs to read the version.
+	ctx := context.Background()
+	var icepanelClient *api.IcePanelClient
+	if !*dryRun || *wipe || *validateRemote {
+		var cancel context.CancelFunc
+		ctx, cancel, icepanelClient, err = vf.connect()
+		if err != nil {
+			return err
+		}
+		defer cancel()
+	}
+
+	// Check relationship endpoints before touching IcePanel
+	if *validateRemote {
+		err = validate.Remote(ctx, icepanelClient, vf.landscape, vf.version, diagram)
+	} else {
+		err = validate.Local(diagram)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Set diagram name from command line
+	diagram.Name = *diagramName
+
+	if *dryRun {
+		report := &dryrun.Report{Landscape: vf.landscape, Version: vf.version, Diagram: diagram}
+		if *wipe {
+			if report.Wipe, err = icepanelClient.WipeTargets(ctx, vf.landscape, vf.version); err != nil {
+				return err
+			}
+		}
+		if *jsonOut {
+			return report.WriteJSON(stdout)
+		}
+		return report.Write(stdout)
+	}
+
+	// Wipe existing content if requested
+	if *wipe {
+		if vf.verbose {
+			log.Printf("Wiping existing content in landscape %s, version %s", vf.landscape, vf.version)
+		}
+		if err := icepanelClient.WipeVersion(ctx, vf.landscape, vf.version); err != nil {
+			return err
+		}
+	}
+
+	// Upload diagram
+	if vf.verbose {
+		log.Printf("Uploading diagram '%s' with %d objects and %d connections",
+			diagram.Name, len(diagram.Objects), len(diagram.Connections))
+	}
+
+	if err := icepanelClient.PostDiagram(ctx, vf.landscape, vf.version, diagram, vf.verbose); err != nil {
+		return err
+	}
+
+	if vf.verbose {
+		log.Println("Import completed successfully")
+	}
+
+	return nil
+}
+
+// runExport writes the objects and connections of a version as Mermaid C4.
+func runExport(fs *flag.FlagSet, args []string, stdout io.Writer) error {
+	var vf versionFlags
+	vf.register(fs)
+	output := fs.String("o", "", "Write the Mermaid file here instead of stdout")
+	title := fs.String("name", "", "Diagram title")
+	if err := vf.parse(fs, args); err != nil {
+		return err
+	}
+	if err := requireFlags(fs, "landscape", "version"); err != nil {
+		return err
+	}
+
+	ctx, cancel, icepanelClient, err := vf.connect()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	diagram, err := export.Fetch(ctx, icepanelClient, vf.landscape, vf.version)
+	if err != nil {
+		return err
+	}
+	diagram.Name = *title
+	if vf.verbose {
+		log.Printf("Exporting %d objects and %d connections", len(diagram.Objects), len(diagram.Connections))
+	}
+
+	if *output == "" {
+		return export.Write(stdout, diagram)
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", *output, err)
+	}
+	if err := export.Write(f, diagram); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// runWipe deletes everything in a version.
+func runWipe(fs *flag.FlagSet, args []string, _ io.Writer) error {
+	var vf versionFlags
+	vf.register(fs)
+	if err := vf.parse(fs, args); err != nil {
+		return err
+	}
+	if err := requireFlags(fs, "landscape", "version"); err != nil {
+		return err
+	}
+
+	ctx, cancel, icepanelClient, err := vf.connect()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	if vf.verbose {
+		log.Printf("Wiping existing content in landscape %s, version %s", vf.landscape, vf.version)
+	}
+	return icepanelClient.WipeVersion(ctx, vf.landscape, vf.version)
+}
+
+// runValidate parses a Mermaid file and checks its relationships, without
+// contacting IcePanel unless -remote is given.
+func runValidate(fs *flag.FlagSet, args []string, stdout io.Writer) error {
+	var vf versionFlags
+	var mf mermaidFlags
+	vf.register(fs)
+	mf.register(fs)
+	remote := fs.Bool("remote", false,
+		"Allow relationships to reference objects that already exist in the IcePanel version")
+	if err := vf.parse(fs, args); err != nil {
+		return err
+	}
+	required := []string{"mmd"}
+	if *remote {
+		required = append(required, "landscape", "version")
+	}
+	if err := requireFlags(fs, required...); err != nil {
+		return err
+	}
+
+	diagram, err := mf.parse()
+	if err != nil {
+		return err
+	}
+	if *remote {
+		ctx, cancel, icepanelClient, cerr := vf.connect()
+		if cerr != nil {
+			return cerr
+		}
+		defer cancel()
+		err = validate.Remote(ctx, icepanelClient, vf.landscape, vf.version, diagram)
+	} else {
+		err = validate.Local(diagram)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(stdout, "%s: %d objects, %d connections\n",
+		mf.file, len(diagram.Objects), len(diagram.Connections))
+	return err
+}
+
+// runDiff prints the differences between a version and a Mermaid file and
+// fails when there are any.
+func runDiff(fs *flag.FlagSet, args []string, stdout io.Writer) error {
+	return reconcileCommand(fs, args, stdout, reconcileDiff)
+}
+
+// runPlan prints the changes needed to sync a version with a Mermaid file.
+func runPlan(fs *flag.FlagSet, args []string, stdout io.Writer) error {
+	return reconcileCommand(fs, args, stdout, reconcilePlan)
+}
+
+// runApply makes the planned changes to a version.
+func runApply(fs *flag.FlagSet, args []string, stdout io.Writer) error {
+	return reconcileCommand(fs, args, stdout, reconcileApply)
+}
+
+// reconcileMode says what diff, plan and apply do once the plan is printed.
+type reconcileMode int
+
+const (
+	reconcileDiff reconcileMode = iota
+	reconcilePlan
+	reconcileApply
+)
+
+// reconcileCommand prints the plan that would bring a version in line with
+// a Mermaid file, then fails on drift or applies it depending on the mode.
+func reconcileCommand(fs *flag.FlagSet, args []string, stdout io.Writer, mode reconcileMode) error {
+	var vf versionFlags
+	var mf mermaidFlags
+	vf.register(fs)
+	mf.register(fs)
+	if err := vf.parse(fs, args); err != nil {
+		return err
+	}
+	if err := requireFlags(fs, "mmd", "landscape", "version"); err != nil {
+		return err
+	}
+
+	diagram, err := mf.parse()
+	if err != nil {
+		return err
+	}
+	if err := validate.Local(diagram); err != nil {
+		return err
+	}
+
+	ctx, cancel, icepanelClient, err := vf.connect()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	if vf.verbose {
+		log.Printf("Computing plan for landscape %s, version %s", vf.landscape, vf.version)
+	}
+	p, err := reconcile.Fetch(ctx, icepanelClient, vf.landscape, vf.version, diagram)
+	if err != nil {
+		return err
+	}
+	if err := p.Write(stdout); err != nil {
+		return err
+	}
+
+	switch {
+	case p.Empty():
+		return nil
+	case mode == reconcileDiff:
+		return &driftError{msg: fmt.Sprintf("version %s differs from %s", vf.version, mf.file)}
+	case mode == reconcilePlan:
+		return nil
+	}
+	if err := reconcile.Apply(ctx, icepanelClient, vf.landscape, vf.version, p); err != nil {
+		return err
+	}
+	if vf.verbose {
+		log.Println("Apply completed successfully")
+	}
+	return nil
+}
+
+// runList prints the objects and connections in a version as tables.
+func runList(fs *flag.FlagSet, args []string, stdout io.Writer) error {
+	var vf versionFlags
+	vf.register(fs)
+	if err := vf.parse(fs, args); err != nil {
+		return err
+	}
+	if err := requireFlags(fs, "landscape", "version"); err != nil {
+		return err
+	}
+
+	ctx, cancel, icepanelClient, err := vf.connect()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	diagram, err := export.Fetch(ctx, icepanelClient, vf.landscape, vf.version)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "HANDLE\tTYPE\tNAME\tPARENT")
+	for _, o := range diagram.Objects {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", o.Handle, o.Type, o.Name, o.Parent)
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "HANDLE\tFROM\tTO\tLABEL")
+	for _, c := range diagram.Connections {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", c.Handle, c.From, c.To, c.Label)
+	}
+	return tw.Flush()
+}
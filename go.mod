@@ -2,4 +2,6 @@ module mermaid-icepanel
 
 go 1.24.2
 
-require google.golang.org/protobuf v1.36.6 // indirect
+require google.golang.org/protobuf v1.36.6
+
+require gopkg.in/yaml.v3 v3.0.1
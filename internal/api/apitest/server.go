@@ -0,0 +1,457 @@
+// Package apitest provides an in-memory fake of the IcePanel API for tests.
+//
+// The fake keeps landscapes, versions and their objects, connections,
+// diagrams and diagram groups in memory, paginates list responses, and can
+// be told to fail specific requests so retry and error paths can be exercised.
+package apitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+
+	"mermaid-icepanel/internal/api"
+)
+
+// Content kinds stored per version, as they appear in API paths.
+const (
+	KindObjects       = "model/objects"
+	KindConnections   = "model/connections"
+	KindDiagrams      = "diagrams"
+	KindDiagramGroups = "diagram-groups"
+)
+
+var kinds = []string{KindObjects, KindConnections, KindDiagrams, KindDiagramGroups}
+
+// item is a stored resource; "id" is always set, and equals "handleId" for
+// model objects and connections, which the client addresses by handle.
+type item map[string]interface{}
+
+// collection keeps items in insertion order so listings are stable.
+type collection struct {
+	order []string
+	items map[string]item
+}
+
+func (c *collection) put(id string, it item) {
+	if _, ok := c.items[id]; !ok {
+		c.order = append(c.order, id)
+	}
+	c.items[id] = it
+}
+
+func (c *collection) remove(id string) bool {
+	if _, ok := c.items[id]; !ok {
+		return false
+	}
+	delete(c.items, id)
+	for i, o := range c.order {
+		if o == id {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+func (c *collection) list() []item {
+	out := make([]item, len(c.order))
+	for i, id := range c.order {
+		out[i] = c.items[id]
+	}
+	return out
+}
+
+type version map[string]*collection
+
+// failure is an injected error response.
+type failure struct {
+	method    string
+	pathMatch string
+	status    int
+	remaining int
+}
+
+// Server is an httptest server backed by an in-memory IcePanel model.
+type Server struct {
+	*httptest.Server
+
+	// Token, when set, must be sent as a bearer token on every request.
+	Token string
+
+	// IgnorePage, when set, makes list endpoints return every item whatever
+	// page is asked for, like a server that does not paginate.
+	IgnorePage bool
+	// NextCursor, when set, is returned as the cursor of every list page.
+	NextCursor string
+
+	mu         sync.Mutex
+	landscapes map[string]map[string]version
+	failures   []*failure
+	requests   []string
+	seq        int
+}
+
+// NewServer starts a fake IcePanel API. Callers must Close it.
+func NewServer() *Server {
+	s := &Server{landscapes: make(map[string]map[string]version)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /landscapes/{lc}", s.getLandscape)
+	mux.HandleFunc("GET /landscapes/{lc}/versions/{ver}", s.getVersion)
+	for _, kind := range kinds {
+		base := "/landscapes/{lc}/versions/{ver}/" + kind
+		mux.HandleFunc("GET "+base, s.list(kind))
+		mux.HandleFunc("POST "+base, s.create(kind))
+		mux.HandleFunc("GET "+base+"/{id}", s.get(kind))
+		mux.HandleFunc("PUT "+base+"/{id}", s.update(kind))
+		mux.HandleFunc("DELETE "+base+"/{id}", s.remove(kind))
+	}
+	s.Server = httptest.NewServer(s.middleware(mux))
+	return s
+}
+
+// AddVersion registers a landscape version so requests against it succeed.
+func (s *Server) AddVersion(lc, ver string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version(lc, ver, true)
+}
+
+// Fail makes the next n requests whose method matches and whose path
+// contains pathMatch respond with status. An empty method matches any method.
+func (s *Server) Fail(method, pathMatch string, status, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, &failure{method: method, pathMatch: pathMatch, status: status, remaining: n})
+}
+
+// Requests returns every request received so far as "METHOD /path".
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// Seed stores items of the given kind directly, bypassing the API.
+func (s *Server) Seed(lc, ver, kind string, items ...interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	col := s.version(lc, ver, true)[kind]
+	for _, v := range items {
+		it, err := toItem(v)
+		if err != nil {
+			panic(fmt.Sprintf("apitest: cannot seed %T: %v", v, err))
+		}
+		col.put(s.assignID(kind, it), it)
+	}
+}
+
+// Objects returns the objects currently stored in a version.
+func (s *Server) Objects(lc, ver string) []*api.Object {
+	var out []*api.Object
+	s.decodeAll(lc, ver, KindObjects, &out)
+	return out
+}
+
+// Connections returns the connections currently stored in a version.
+func (s *Server) Connections(lc, ver string) []*api.Connection {
+	var out []*api.Connection
+	s.decodeAll(lc, ver, KindConnections, &out)
+	return out
+}
+
+// Count returns how many items of a kind are stored in a version.
+func (s *Server) Count(lc, ver, kind string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := s.version(lc, ver, false)
+	if v == nil {
+		return 0
+	}
+	return len(v[kind].order)
+}
+
+func (s *Server) decodeAll(lc, ver, kind string, out interface{}) {
+	s.mu.Lock()
+	var items []item
+	if v := s.version(lc, ver, false); v != nil {
+		items = v[kind].list()
+	}
+	s.mu.Unlock()
+	b, err := json.Marshal(items)
+	if err == nil {
+		err = json.Unmarshal(b, out)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("apitest: cannot decode %s: %v", kind, err))
+	}
+}
+
+// version returns the stored version, creating it if create is set.
+// Callers must hold s.mu.
+func (s *Server) version(lc, ver string, create bool) version {
+	vs, ok := s.landscapes[lc]
+	if !ok {
+		if !create {
+			return nil
+		}
+		vs = make(map[string]version)
+		s.landscapes[lc] = vs
+	}
+	v, ok := vs[ver]
+	if !ok {
+		if !create {
+			return nil
+		}
+		v = make(version)
+		for _, kind := range kinds {
+			v[kind] = &collection{items: make(map[string]item)}
+		}
+		vs[ver] = v
+	}
+	return v
+}
+
+// assignID sets and returns the item's id. Callers must hold s.mu.
+func (s *Server) assignID(kind string, it item) string {
+	if kind == KindObjects || kind == KindConnections {
+		if h, ok := it["handleId"].(string); ok && h != "" {
+			it["id"] = h
+			return h
+		}
+	}
+	if id, ok := it["id"].(string); ok && id != "" {
+		return id
+	}
+	s.seq++
+	id := fmt.Sprintf("%s-%d", strings.TrimPrefix(kind, "model/"), s.seq)
+	it["id"] = id
+	return id
+}
+
+func (s *Server) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		token := s.Token
+		var injected *failure
+		for _, f := range s.failures {
+			if f.remaining > 0 && (f.method == "" || f.method == r.Method) && strings.Contains(r.URL.Path, f.pathMatch) {
+				f.remaining--
+				injected = f
+				break
+			}
+		}
+		s.mu.Unlock()
+
+		if injected != nil {
+			writeError(w, injected.status, "injected failure")
+			return
+		}
+		if token != "" && r.Header.Get("Authorization") != "Bearer "+token {
+			writeError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) getLandscape(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	_, ok := s.landscapes[r.PathValue("lc")]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "landscape not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, item{"id": r.PathValue("lc")})
+}
+
+func (s *Server) getVersion(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	v := s.version(r.PathValue("lc"), r.PathValue("ver"), false)
+	s.mu.Unlock()
+	if v == nil {
+		writeError(w, http.StatusNotFound, "version not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, item{"id": r.PathValue("ver")})
+}
+
+func (s *Server) list(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		per, pageNum := pageParams(r)
+		s.mu.Lock()
+		v := s.version(r.PathValue("lc"), r.PathValue("ver"), false)
+		var all []item
+		if v != nil {
+			all = v[kind].list()
+		}
+		ignorePage, cursor := s.IgnorePage, s.NextCursor
+		s.mu.Unlock()
+		if v == nil {
+			writeError(w, http.StatusNotFound, "version not found")
+			return
+		}
+		page := item{"data": all}
+		if !ignorePage {
+			start := min((pageNum-1)*per, len(all))
+			page["data"] = all[start:min(start+per, len(all))]
+		}
+		if cursor != "" {
+			page["nextCursor"] = cursor
+		}
+		writeJSON(w, http.StatusOK, page)
+	}
+}
+
+func (s *Server) create(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var it item
+		if err := json.NewDecoder(r.Body).Decode(&it); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		v := s.version(r.PathValue("lc"), r.PathValue("ver"), false)
+		if v == nil {
+			writeError(w, http.StatusNotFound, "version not found")
+			return
+		}
+		// Diagrams carry their own model; store it like IcePanel would.
+		if kind == KindDiagrams {
+			if status, msg := s.storeDiagramModel(v, it); status != 0 {
+				writeError(w, status, msg)
+				return
+			}
+		}
+		id := s.assignID(kind, it)
+		if _, exists := v[kind].items[id]; exists {
+			writeError(w, http.StatusConflict, fmt.Sprintf("%s %s already exists", kind, id))
+			return
+		}
+		v[kind].put(id, it)
+		writeJSON(w, http.StatusCreated, it)
+	}
+}
+
+// storeDiagramModel adds the objects and connections embedded in a posted
+// diagram to the version. Callers must hold s.mu.
+func (s *Server) storeDiagramModel(v version, diagram item) (int, string) {
+	for _, field := range []struct{ key, kind string }{{"objects", KindObjects}, {"connections", KindConnections}} {
+		list, _ := diagram[field.key].([]interface{})
+		for _, raw := range list {
+			it, ok := raw.(map[string]interface{})
+			if !ok {
+				return http.StatusBadRequest, "invalid " + field.key
+			}
+			cp := item{}
+			for k, val := range it {
+				cp[k] = val
+			}
+			v[field.kind].put(s.assignID(field.kind, cp), cp)
+		}
+		delete(diagram, field.key)
+	}
+	return 0, ""
+}
+
+func (s *Server) get(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		v := s.version(r.PathValue("lc"), r.PathValue("ver"), false)
+		var it item
+		if v != nil {
+			it = v[kind].items[r.PathValue("id")]
+		}
+		s.mu.Unlock()
+		if it == nil {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("%s %s not found", kind, r.PathValue("id")))
+			return
+		}
+		writeJSON(w, http.StatusOK, it)
+	}
+}
+
+func (s *Server) update(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var it item
+		if err := json.NewDecoder(r.Body).Decode(&it); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+		id := r.PathValue("id")
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		v := s.version(r.PathValue("lc"), r.PathValue("ver"), false)
+		if v == nil || v[kind].items[id] == nil {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("%s %s not found", kind, id))
+			return
+		}
+		if kind == KindObjects || kind == KindConnections {
+			// A different handle in the body would rename the item, so callers
+			// must not rely on the path alone.
+			if h, ok := it["handleId"]; ok && h != id {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("handleId %v does not match %s %s", h, kind, id))
+				return
+			}
+			it["handleId"] = id
+		}
+		it["id"] = id
+		v[kind].put(id, it)
+		writeJSON(w, http.StatusOK, it)
+	}
+}
+
+func (s *Server) remove(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		s.mu.Lock()
+		v := s.version(r.PathValue("lc"), r.PathValue("ver"), false)
+		ok := v != nil && v[kind].remove(id)
+		s.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("%s %s not found", kind, id))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func pageParams(r *http.Request) (per, pageNum int) {
+	per, err := strconv.Atoi(r.URL.Query().Get("per"))
+	if err != nil || per <= 0 {
+		per = 100
+	}
+	pageNum, err = strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || pageNum <= 0 {
+		pageNum = 1
+	}
+	return per, pageNum
+}
+
+func toItem(v interface{}) (item, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var it item
+	err = json.Unmarshal(b, &it)
+	return it, err
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v) //nolint:errchkjson // nothing to do if the client went away
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("X-Request-Id", "fake-"+strconv.Itoa(status))
+	writeJSON(w, status, item{"message": msg})
+}
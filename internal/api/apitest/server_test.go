@@ -0,0 +1,207 @@
+package apitest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"mermaid-icepanel/internal/api"
+	"mermaid-icepanel/internal/api/apitest"
+	"mermaid-icepanel/internal/config"
+)
+
+func newClient(srv *apitest.Server, retries int) *api.IcePanelClient {
+	cfg := &config.Config{
+		APIBaseURL:  srv.URL,
+		Concurrency: 4,
+		Retry:       config.RetryPolicy{MaxRetries: retries, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+	}
+	httpClient := api.NewRetryingHTTPClient(&api.DefaultHTTPClient{Client: srv.Client()}, cfg.Retry)
+	return api.NewIcePanelClient(cfg, httpClient, "secret")
+}
+
+func TestServer_ObjectLifecycle(t *testing.T) {
+	ctx := context.Background()
+	srv := apitest.NewServer()
+	defer srv.Close()
+	srv.Token = "secret"
+	srv.AddVersion("lc", "v1")
+	client := newClient(srv, 0)
+
+	if err := client.ValidateLandscapeVersion(ctx, "lc", "v1"); err != nil {
+		t.Fatalf("ValidateLandscapeVersion() error = %v", err)
+	}
+	objs := []*api.Object{
+		{Handle: "b", Name: "Boundary", Type: "group"},
+		{Handle: "a", Name: "API", Type: "app", Parent: "b"},
+	}
+	if err := client.CreateObjects(ctx, "lc", "v1", objs); err != nil {
+		t.Fatalf("CreateObjects() error = %v", err)
+	}
+	if err := client.CreateObject(ctx, "lc", "v1", objs[0], false); !errors.Is(err, api.ErrConflict) {
+		t.Errorf("CreateObject() duplicate error = %v, want ErrConflict", err)
+	}
+
+	upd := *objs[1]
+	upd.Name = "Gateway"
+	if err := client.UpdateObject(ctx, "lc", "v1", "a", &upd, false); err != nil {
+		t.Fatalf("UpdateObject() error = %v", err)
+	}
+	var apiErr *api.APIError
+	err := client.UpdateObject(ctx, "lc", "v1", "b", &upd, false)
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("UpdateObject() with another handle error = %v, want 400", err)
+	}
+	got, err := client.GetObject(ctx, "lc", "v1", "a")
+	if err != nil {
+		t.Fatalf("GetObject() error = %v", err)
+	}
+	if !got.Equal(&upd) {
+		t.Errorf("GetObject() = %+v, want %+v", got, upd)
+	}
+
+	if err := client.DeleteObject(ctx, "lc", "v1", "a"); err != nil {
+		t.Fatalf("DeleteObject() error = %v", err)
+	}
+	if _, err := client.GetObject(ctx, "lc", "v1", "a"); !errors.Is(err, api.ErrNotFound) {
+		t.Errorf("GetObject() after delete error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestServer_PostDiagramAndWipe(t *testing.T) {
+	ctx := context.Background()
+	srv := apitest.NewServer()
+	defer srv.Close()
+	srv.AddVersion("lc", "v1")
+	srv.Seed("lc", "v1", apitest.KindDiagramGroups, map[string]string{"name": "old group"})
+	client := newClient(srv, 0)
+
+	d := &api.Diagram{
+		Name:        "Context",
+		Objects:     []*api.Object{{Handle: "u", Name: "User", Type: "actor"}, {Handle: "s", Name: "Shop", Type: "system"}},
+		Connections: []*api.Connection{{Handle: "h0001", From: "u", To: "s", Label: "uses"}},
+	}
+	if err := client.PostDiagram(ctx, "lc", "v1", d, false); err != nil {
+		t.Fatalf("PostDiagram() error = %v", err)
+	}
+	if got := len(srv.Objects("lc", "v1")); got != 2 {
+		t.Errorf("objects after PostDiagram = %d, want 2", got)
+	}
+	if got := len(srv.Connections("lc", "v1")); got != 1 {
+		t.Errorf("connections after PostDiagram = %d, want 1", got)
+	}
+
+	if err := client.WipeVersion(ctx, "lc", "v1"); err != nil {
+		t.Fatalf("WipeVersion() error = %v", err)
+	}
+	for _, kind := range []string{
+		apitest.KindObjects, apitest.KindConnections, apitest.KindDiagrams, apitest.KindDiagramGroups,
+	} {
+		if n := srv.Count("lc", "v1", kind); n != 0 {
+			t.Errorf("%s after wipe = %d, want 0", kind, n)
+		}
+	}
+}
+
+func TestServer_Pagination(t *testing.T) {
+	srv := apitest.NewServer()
+	defer srv.Close()
+	const total = 2500
+	for i := range total {
+		srv.Seed("lc", "v1", apitest.KindObjects, &api.Object{Handle: fmt.Sprintf("o%04d", i), Name: "n", Type: "app"})
+	}
+
+	objs, err := newClient(srv, 0).ListObjects(context.Background(), "lc", "v1")
+	if err != nil {
+		t.Fatalf("ListObjects() error = %v", err)
+	}
+	if len(objs) != total {
+		t.Errorf("ListObjects() returned %d objects, want %d", len(objs), total)
+	}
+	pages := 0
+	for _, r := range srv.Requests() {
+		if r == "GET /landscapes/lc/versions/v1/model/objects" {
+			pages++
+		}
+	}
+	if pages != 3 {
+		t.Errorf("fetched %d pages, want 3", pages)
+	}
+}
+
+func TestServer_PaginationTerminates(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(srv *apitest.Server)
+	}{
+		{"page ignored", func(srv *apitest.Server) { srv.IgnorePage = true }},
+		{"repeated cursor", func(srv *apitest.Server) { srv.NextCursor = "again" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := apitest.NewServer()
+			defer srv.Close()
+			const total = 1500
+			for i := range total {
+				srv.Seed("lc", "v1", apitest.KindObjects, &api.Object{Handle: fmt.Sprintf("o%04d", i), Name: "n", Type: "app"})
+			}
+			tt.setup(srv)
+
+			objs, err := newClient(srv, 0).ListObjects(context.Background(), "lc", "v1")
+			if err != nil {
+				t.Fatalf("ListObjects() error = %v", err)
+			}
+			seen := make(map[string]bool, len(objs))
+			for _, o := range objs {
+				if seen[o.Handle] {
+					t.Fatalf("ListObjects() returned %s twice", o.Handle)
+				}
+				seen[o.Handle] = true
+			}
+			if len(srv.Requests()) > 3 {
+				t.Errorf("fetched %d pages, want at most 3", len(srv.Requests()))
+			}
+		})
+	}
+}
+
+func TestServer_ErrorInjection(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name       string
+		status     int
+		times      int
+		retries    int
+		wantStatus int // 0 means the call succeeds
+	}{
+		{name: "transient failure is retried", status: http.StatusServiceUnavailable, times: 2, retries: 3},
+		{name: "retries exhausted", status: http.StatusBadGateway, times: 5, retries: 1,
+			wantStatus: http.StatusBadGateway},
+		{name: "unauthorized is not retried", status: http.StatusUnauthorized, times: 1, retries: 3,
+			wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := apitest.NewServer()
+			defer srv.Close()
+			srv.AddVersion("lc", "v1")
+			srv.Fail(http.MethodGet, "/model/objects", tt.status, tt.times)
+
+			_, err := newClient(srv, tt.retries).ListObjects(ctx, "lc", "v1")
+			if tt.wantStatus == 0 {
+				if err != nil {
+					t.Fatalf("ListObjects() error = %v", err)
+				}
+				return
+			}
+			var apiErr *api.APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.wantStatus {
+				t.Errorf("ListObjects() error = %v, want status %d", err, tt.wantStatus)
+			}
+		})
+	}
+}
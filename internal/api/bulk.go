@@ -0,0 +1,193 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// defaultConcurrency is used when the client has no concurrency configured.
+const defaultConcurrency = 1
+
+// BulkFailure is a single failed item of a bulk operation.
+type BulkFailure struct {
+	ID  string
+	Err error
+}
+
+// BulkError reports every item that failed in a bulk operation.
+type BulkError struct {
+	Op       string // e.g. "delete model/objects"
+	Failures []BulkFailure
+}
+
+func (e *BulkError) Error() string {
+	msgs := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		msgs[i] = fmt.Sprintf("%s: %v", f.ID, f.Err)
+	}
+	return fmt.Sprintf("%s: %d failed: %s", e.Op, len(e.Failures), strings.Join(msgs, "; "))
+}
+
+// Unwrap exposes the individual failures to errors.Is and errors.As.
+func (e *BulkError) Unwrap() []error {
+	errs := make([]error, len(e.Failures))
+	for i, f := range e.Failures {
+		errs[i] = f.Err
+	}
+	return errs
+}
+
+// forEach runs fn for every id using at most c.concurrency workers. Every id
+// is attempted; failures are collected into a BulkError sorted by id.
+func (c *IcePanelClient) forEach(ctx context.Context, op string, ids []string,
+	fn func(ctx context.Context, id string) error,
+) error {
+	workers := c.concurrency
+	if workers <= 0 {
+		workers = defaultConcurrency
+	}
+	if workers > len(ids) {
+		workers = len(ids)
+	}
+
+	var (
+		mu       sync.Mutex
+		failures []BulkFailure
+		wg       sync.WaitGroup
+	)
+	work := make(chan string)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range work {
+				if err := fn(ctx, id); err != nil {
+					mu.Lock()
+					failures = append(failures, BulkFailure{ID: id, Err: err})
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, id := range ids {
+		work <- id
+	}
+	close(work)
+	wg.Wait()
+
+	if len(failures) == 0 {
+		return nil
+	}
+	sort.Slice(failures, func(i, j int) bool { return failures[i].ID < failures[j].ID })
+	return &BulkError{Op: op, Failures: failures}
+}
+
+// CreateObjects creates objects concurrently. Objects nested under other
+// objects in the batch are created only after their parents.
+func (c *IcePanelClient) CreateObjects(ctx context.Context, lc, ver string, objs []*Object) error {
+	for _, level := range byDepth(objs) {
+		byHandle := indexObjects(level)
+		err := c.forEach(ctx, "create model/objects", handlesOf(level), func(ctx context.Context, h string) error {
+			return c.CreateObject(ctx, lc, ver, byHandle[h], false)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateObjects updates objects concurrently, each by its own handle.
+func (c *IcePanelClient) UpdateObjects(ctx context.Context, lc, ver string, objs []*Object) error {
+	byHandle := indexObjects(objs)
+	return c.forEach(ctx, "update model/objects", handlesOf(objs), func(ctx context.Context, h string) error {
+		return c.UpdateObject(ctx, lc, ver, h, byHandle[h], false)
+	})
+}
+
+// DeleteObjects deletes objects concurrently. Objects nested under other
+// objects in the batch are deleted before their parents.
+func (c *IcePanelClient) DeleteObjects(ctx context.Context, lc, ver string, objs []*Object) error {
+	levels := byDepth(objs)
+	for i := len(levels) - 1; i >= 0; i-- {
+		if err := c.delAll(ctx, lc, ver, "model/objects", handlesOf(levels[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateConnections creates connections concurrently.
+func (c *IcePanelClient) CreateConnections(ctx context.Context, lc, ver string, conns []*Connection) error {
+	byHandle := make(map[string]*Connection, len(conns))
+	handles := make([]string, len(conns))
+	for i, conn := range conns {
+		byHandle[conn.Handle] = conn
+		handles[i] = conn.Handle
+	}
+	return c.forEach(ctx, "create model/connections", handles, func(ctx context.Context, h string) error {
+		return c.CreateConnection(ctx, lc, ver, byHandle[h], false)
+	})
+}
+
+// UpdateConnections updates connections concurrently, keyed by the handle of
+// the connection to update.
+func (c *IcePanelClient) UpdateConnections(ctx context.Context, lc, ver string, conns map[string]*Connection) error {
+	handles := make([]string, 0, len(conns))
+	for h := range conns {
+		handles = append(handles, h)
+	}
+	return c.forEach(ctx, "update model/connections", handles, func(ctx context.Context, h string) error {
+		return c.UpdateConnection(ctx, lc, ver, h, conns[h], false)
+	})
+}
+
+// DeleteConnections deletes connections concurrently.
+func (c *IcePanelClient) DeleteConnections(ctx context.Context, lc, ver string, handles []string) error {
+	return c.delAll(ctx, lc, ver, "model/connections", handles)
+}
+
+// byDepth groups objects by how deeply they are nested under other objects
+// of the same batch, shallowest first.
+func byDepth(objs []*Object) [][]*Object {
+	parents := make(map[string]string, len(objs))
+	for _, o := range objs {
+		parents[o.Handle] = o.Parent
+	}
+	var levels [][]*Object
+	for _, o := range objs {
+		d := 0
+		seen := map[string]bool{o.Handle: true}
+		for h := o.Parent; h != "" && !seen[h]; h = parents[h] {
+			if _, inBatch := parents[h]; !inBatch {
+				break
+			}
+			seen[h] = true
+			d++
+		}
+		for len(levels) <= d {
+			levels = append(levels, nil)
+		}
+		levels[d] = append(levels[d], o)
+	}
+	return levels
+}
+
+func indexObjects(objs []*Object) map[string]*Object {
+	m := make(map[string]*Object, len(objs))
+	for _, o := range objs {
+		m[o.Handle] = o
+	}
+	return m
+}
+
+func handlesOf(objs []*Object) []string {
+	hs := make([]string, len(objs))
+	for i, o := range objs {
+		hs[i] = o.Handle
+	}
+	return hs
+}
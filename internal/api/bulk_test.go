@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIcePanelClient_DeleteConnections_Concurrency(t *testing.T) {
+	var inFlight, peak int32
+	mockClient := &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			n := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			return NewMockResponse(http.StatusNoContent, ""), nil
+		},
+	}
+	client := &IcePanelClient{httpClient: mockClient, baseURL: "https://test.api.com", concurrency: 3}
+
+	handles := []string{"c1", "c2", "c3", "c4", "c5", "c6", "c7", "c8", "c9"}
+	if err := client.DeleteConnections(context.Background(), "land1", "ver1", handles); err != nil {
+		t.Fatalf("DeleteConnections() error = %v", err)
+	}
+	if peak > 3 {
+		t.Errorf("peak concurrency = %d, want <= 3", peak)
+	}
+	if peak < 2 {
+		t.Errorf("peak concurrency = %d, expected requests to overlap", peak)
+	}
+}
+
+func TestIcePanelClient_CreateObjects_ParentsFirst(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		created  = make(map[string]bool)
+		badOrder []string
+	)
+	parents := map[string]string{"sys": "", "app": "sys", "comp": "app", "other": ""}
+	mockClient := &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			var obj Object
+			if err := decodeBody(req, &obj); err != nil {
+				return nil, err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if p := parents[obj.Handle]; p != "" && !created[p] {
+				badOrder = append(badOrder, obj.Handle)
+			}
+			created[obj.Handle] = true
+			return NewMockResponse(http.StatusCreated, `{}`), nil
+		},
+	}
+	client := &IcePanelClient{httpClient: mockClient, baseURL: "https://test.api.com", concurrency: 4}
+
+	objs := []*Object{
+		{Handle: "comp", Parent: "app"},
+		{Handle: "app", Parent: "sys"},
+		{Handle: "sys"},
+		{Handle: "other", Parent: "outside-batch"},
+	}
+	if err := client.CreateObjects(context.Background(), "land1", "ver1", objs); err != nil {
+		t.Fatalf("CreateObjects() error = %v", err)
+	}
+	if len(badOrder) > 0 || len(created) != 4 {
+		t.Errorf("created %v, created before parent: %v", created, badOrder)
+	}
+}
+
+func TestIcePanelClient_UpdateObjects_AggregatesErrors(t *testing.T) {
+	mockClient := &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			if strings.HasSuffix(req.URL.Path, "/bad1") || strings.HasSuffix(req.URL.Path, "/bad2") {
+				return nil, errors.New("boom")
+			}
+			return NewMockResponse(http.StatusOK, `{}`), nil
+		},
+	}
+	client := &IcePanelClient{httpClient: mockClient, baseURL: "https://test.api.com", concurrency: 2}
+
+	objs := []*Object{{Handle: "bad2"}, {Handle: "ok"}, {Handle: "bad1"}}
+	err := client.UpdateObjects(context.Background(), "land1", "ver1", objs)
+	var berr *BulkError
+	if !errors.As(err, &berr) {
+		t.Fatalf("UpdateObjects() error = %v, want BulkError", err)
+	}
+	if len(berr.Failures) != 2 || berr.Failures[0].ID != "bad1" || berr.Failures[1].ID != "bad2" {
+		t.Errorf("Failures = %+v, want bad1 and bad2", berr.Failures)
+	}
+	if !strings.Contains(err.Error(), "update model/objects: 2 failed") {
+		t.Errorf("unexpected message: %v", err)
+	}
+}
+
+func decodeBody(req *http.Request, v interface{}) error {
+	return json.NewDecoder(req.Body).Decode(v)
+}
@@ -33,7 +33,8 @@ type Object struct {
 	Handle string                 `json:"handleId"`
 	Name   string                 `json:"name"`
 	Desc   string                 `json:"description,omitempty"`
-	Type   string                 `json:"type"` // actor, system, store, group
+	Type   string                 `json:"type"` // actor, system, app, store, component, group
+	Parent string                 `json:"parentId,omitempty"`
 	Props  map[string]interface{} `json:"properties,omitempty"`
 }
 
@@ -55,9 +56,11 @@ type Diagram struct {
 
 // IcePanelClient handles communication with the IcePanel API.
 type IcePanelClient struct {
-	httpClient HTTPClient
-	Token      string // Export Token field
-	baseURL    string
+	httpClient  HTTPClient
+	Token       string // Export Token field
+	baseURL     string
+	pageSize    int // items per page for list calls; defaultPageSize if zero
+	concurrency int // parallel requests for bulk operations; defaultConcurrency if zero
 }
 
 // NewIcePanelClient creates a new client for IcePanel API.
@@ -69,9 +72,10 @@ func NewIcePanelClient(config *config.Config, client HTTPClient, token string) *
 	}
 
 	return &IcePanelClient{
-		httpClient: client,
-		Token:      apiToken,
-		baseURL:    config.APIBaseURL,
+		httpClient:  client,
+		Token:       apiToken,
+		baseURL:     config.APIBaseURL,
+		concurrency: config.Concurrency,
 	}
 }
 
@@ -86,84 +90,73 @@ func (c *IcePanelClient) call(ctx context.Context, method, url string, body []by
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
-	return c.httpClient.Do(req)
+	resp, err := c.httpClient.Do(req)
+	if err == nil && resp.Request == nil {
+		// http.Client always sets this; other HTTPClients may not, and
+		// APIError needs it to report which request failed.
+		resp.Request = req
+	}
+	return resp, err
 }
 
 func (c *IcePanelClient) listIDs(ctx context.Context, lc, ver, path string) ([]string, error) {
-	url := fmt.Sprintf("%s/landscapes/%s/versions/%s/%s?per=1000", c.baseURL, lc, ver, path)
-	resp, err := c.call(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-	defer func() {
-		if cerr := resp.Body.Close(); cerr != nil {
-			log.Printf("Error closing response body: %v", cerr)
-		}
-	}()
-	var out struct {
-		Data []struct {
-			ID string `json:"id"`
-		} `json:"data"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		return nil, err
-	}
-	ids := make([]string, len(out.Data))
-	for i, d := range out.Data {
-		ids[i] = d.ID
-	}
-	return ids, nil
+	return collect(c.IterIDs(ctx, lc, ver, path))
 }
 
 func (c *IcePanelClient) delAll(ctx context.Context, lc, ver, path string, ids []string) error {
-	for _, id := range ids {
+	return c.forEach(ctx, "delete "+path, ids, func(ctx context.Context, id string) error {
 		url := fmt.Sprintf("%s/landscapes/%s/versions/%s/%s/%s", c.baseURL, lc, ver, path, id)
 		resp, err := c.call(ctx, "DELETE", url, nil)
 		if err != nil {
 			return err
 		}
-		if cerr := resp.Body.Close(); cerr != nil {
-			log.Printf("Error closing response body: %v", cerr)
+		defer func() {
+			if cerr := resp.Body.Close(); cerr != nil {
+				log.Printf("Error closing response body: %v", cerr)
+			}
+		}()
+		return checkResponse(resp)
+	})
+}
+
+// wipePaths are the kinds of content WipeVersion deletes, in order.
+var wipePaths = []string{"diagram-groups", "diagrams", "model/objects", "model/connections"}
+
+// WipeTarget is the content of one kind that a wipe deletes.
+type WipeTarget struct {
+	Path string   `json:"path"` // e.g. "diagrams" or "model/objects"
+	IDs  []string `json:"ids"`
+}
+
+// WipeVersion deletes all content in an IcePanel version. Each kind of content
+// is deleted concurrently, one kind at a time: groups, diagrams, objects, connections.
+func (c *IcePanelClient) WipeVersion(ctx context.Context, lc, ver string) error {
+	for _, path := range wipePaths {
+		ids, err := c.listIDs(ctx, lc, ver, path)
+		if err != nil {
+			return err
 		}
-		if resp.StatusCode >= 300 {
-			return fmt.Errorf("delete %s: status %s", id, resp.Status)
+		if err := c.delAll(ctx, lc, ver, path, ids); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-// WipeVersion deletes all content in an IcePanel version.
-func (c *IcePanelClient) WipeVersion(ctx context.Context, lc, ver string) error {
-	// groups
-	groups, err := c.listIDs(ctx, lc, ver, "diagram-groups")
-	if err != nil {
-		return err
-	}
-	if err := c.delAll(ctx, lc, ver, "diagram-groups", groups); err != nil {
-		return err
-	}
-	// diagrams
-	diags, err := c.listIDs(ctx, lc, ver, "diagrams")
-	if err != nil {
-		return err
-	}
-	if err := c.delAll(ctx, lc, ver, "diagrams", diags); err != nil {
-		return err
-	}
-	// objects
-	objs, err := c.listIDs(ctx, lc, ver, "model/objects")
-	if err != nil {
-		return err
-	}
-	if err := c.delAll(ctx, lc, ver, "model/objects", objs); err != nil {
-		return err
-	}
-	// connections
-	conns, err := c.listIDs(ctx, lc, ver, "model/connections")
-	if err != nil {
-		return err
+// WipeTargets lists what WipeVersion would delete, without deleting anything.
+func (c *IcePanelClient) WipeTargets(ctx context.Context, lc, ver string) ([]WipeTarget, error) {
+	targets := make([]WipeTarget, 0, len(wipePaths))
+	for _, path := range wipePaths {
+		ids, err := c.listIDs(ctx, lc, ver, path)
+		if err != nil {
+			return nil, err
+		}
+		if ids == nil {
+			ids = []string{}
+		}
+		targets = append(targets, WipeTarget{Path: path, IDs: ids})
 	}
-	return c.delAll(ctx, lc, ver, "model/connections", conns)
+	return targets, nil
 }
 
 // PostDiagram uploads a diagram to IcePanel.
@@ -185,8 +178,8 @@ func (c *IcePanelClient) PostDiagram(ctx context.Context, lc, ver string, d *Dia
 			log.Printf("Error closing response body: %v", cerr)
 		}
 	}()
-	if resp.StatusCode >= 300 {
-		return errors.New(resp.Status)
+	if err := checkResponse(resp); err != nil {
+		return err
 	}
 	var out struct {
 		ID string `json:"id"`
@@ -218,8 +211,8 @@ func (c *IcePanelClient) CreateObject(ctx context.Context, lc, ver string, obj *
 			log.Printf("Error closing response body: %v", cerr)
 		}
 	}()
-	if resp.StatusCode >= 300 {
-		return errors.New(resp.Status)
+	if err := checkResponse(resp); err != nil {
+		return err
 	}
 	return nil
 }
@@ -244,8 +237,8 @@ func (c *IcePanelClient) UpdateObject(ctx context.Context, lc, ver, handle strin
 			log.Printf("Error closing response body: %v", cerr)
 		}
 	}()
-	if resp.StatusCode >= 300 {
-		return errors.New(resp.Status)
+	if err := checkResponse(resp); err != nil {
+		return err
 	}
 	return nil
 }
@@ -262,8 +255,8 @@ func (c *IcePanelClient) GetObject(ctx context.Context, lc, ver, handle string)
 			log.Printf("Error closing response body: %v", cerr)
 		}
 	}()
-	if resp.StatusCode >= 300 {
-		return nil, errors.New(resp.Status)
+	if err := checkResponse(resp); err != nil {
+		return nil, err
 	}
 	var obj Object
 	if err := json.NewDecoder(resp.Body).Decode(&obj); err != nil {
@@ -274,7 +267,76 @@ func (c *IcePanelClient) GetObject(ctx context.Context, lc, ver, handle string)
 
 // ListObjects retrieves all objects for a given landscape and version.
 func (c *IcePanelClient) ListObjects(ctx context.Context, lc, ver string) ([]*Object, error) {
-	url := fmt.Sprintf("%s/landscapes/%s/versions/%s/model/objects?per=1000", c.baseURL, lc, ver)
+	return collect(c.IterObjects(ctx, lc, ver))
+}
+
+// DeleteObject deletes an object by handle ID.
+func (c *IcePanelClient) DeleteObject(ctx context.Context, lc, ver, handle string) error {
+	return c.delAll(ctx, lc, ver, "model/objects", []string{handle})
+}
+
+// ListConnections retrieves all connections for a given landscape and version.
+func (c *IcePanelClient) ListConnections(ctx context.Context, lc, ver string) ([]*Connection, error) {
+	return collect(c.IterConnections(ctx, lc, ver))
+}
+
+// CreateConnection creates a new connection in IcePanel.
+func (c *IcePanelClient) CreateConnection(ctx context.Context, lc, ver string, conn *Connection, dryRun bool) error {
+	if dryRun {
+		log.Printf("[Dry-Run] Would create connection: %+v in landscape %s, version %s", conn, lc, ver)
+		return nil
+	}
+	b, err := json.Marshal(conn)
+	if err != nil {
+		return fmt.Errorf("failed to marshal connection: %w", err)
+	}
+	url := fmt.Sprintf("%s/landscapes/%s/versions/%s/model/connections", c.baseURL, lc, ver)
+	resp, err := c.call(ctx, "POST", url, b)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := resp.Body.Close(); cerr != nil {
+			log.Printf("Error closing response body: %v", cerr)
+		}
+	}()
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdateConnection updates an existing connection in IcePanel by handle ID.
+func (c *IcePanelClient) UpdateConnection(ctx context.Context, lc, ver, handle string, conn *Connection,
+	dryRun bool,
+) error {
+	if dryRun {
+		log.Printf("[Dry-Run] Would update connection %s: %+v in landscape %s, version %s", handle, conn, lc, ver)
+		return nil
+	}
+	b, err := json.Marshal(conn)
+	if err != nil {
+		return fmt.Errorf("failed to marshal connection: %w", err)
+	}
+	url := fmt.Sprintf("%s/landscapes/%s/versions/%s/model/connections/%s", c.baseURL, lc, ver, handle)
+	resp, err := c.call(ctx, "PUT", url, b)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := resp.Body.Close(); cerr != nil {
+			log.Printf("Error closing response body: %v", cerr)
+		}
+	}()
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetConnection retrieves a connection by handle ID.
+func (c *IcePanelClient) GetConnection(ctx context.Context, lc, ver, handle string) (*Connection, error) {
+	url := fmt.Sprintf("%s/landscapes/%s/versions/%s/model/connections/%s", c.baseURL, lc, ver, handle)
 	resp, err := c.call(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
@@ -284,16 +346,19 @@ func (c *IcePanelClient) ListObjects(ctx context.Context, lc, ver string) ([]*Ob
 			log.Printf("Error closing response body: %v", cerr)
 		}
 	}()
-	if resp.StatusCode >= 300 {
-		return nil, errors.New(resp.Status)
-	}
-	var out struct {
-		Data []*Object `json:"data"`
+	if err := checkResponse(resp); err != nil {
+		return nil, err
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+	var conn Connection
+	if err := json.NewDecoder(resp.Body).Decode(&conn); err != nil {
 		return nil, err
 	}
-	return out.Data, nil
+	return &conn, nil
+}
+
+// DeleteConnection deletes a connection by handle ID.
+func (c *IcePanelClient) DeleteConnection(ctx context.Context, lc, ver, handle string) error {
+	return c.delAll(ctx, lc, ver, "model/connections", []string{handle})
 }
 
 // Equal compares two IcePanel objects for logical equality (ignores Handle).
@@ -301,7 +366,7 @@ func (o *Object) Equal(other *Object) bool {
 	if o == nil || other == nil {
 		return o == other
 	}
-	if o.Name != other.Name || o.Desc != other.Desc || o.Type != other.Type {
+	if o.Name != other.Name || o.Desc != other.Desc || o.Type != other.Type || o.Parent != other.Parent {
 		return false
 	}
 	if len(o.Props) != len(other.Props) {
@@ -331,6 +396,9 @@ func (o *Object) Diff(other *Object) map[string][2]interface{} {
 	if o.Type != other.Type {
 		diff["Type"] = [2]interface{}{o.Type, other.Type}
 	}
+	if o.Parent != other.Parent {
+		diff["Parent"] = [2]interface{}{o.Parent, other.Parent}
+	}
 	// Compare Props
 	for k, v := range o.Props {
 		if ov, ok := other.Props[k]; !ok || !equalInterface(v, ov) {
@@ -345,6 +413,33 @@ func (o *Object) Diff(other *Object) map[string][2]interface{} {
 	return diff
 }
 
+// Equal compares two IcePanel connections for logical equality (ignores Handle).
+func (c *Connection) Equal(other *Connection) bool {
+	if c == nil || other == nil {
+		return c == other
+	}
+	return c.From == other.From && c.To == other.To && c.Label == other.Label
+}
+
+// Diff returns a map of fields that differ between two connections (ignores Handle).
+func (c *Connection) Diff(other *Connection) map[string][2]interface{} {
+	diff := make(map[string][2]interface{})
+	if c == nil || other == nil {
+		diff["nil"] = [2]interface{}{c, other}
+		return diff
+	}
+	if c.From != other.From {
+		diff["From"] = [2]interface{}{c.From, other.From}
+	}
+	if c.To != other.To {
+		diff["To"] = [2]interface{}{c.To, other.To}
+	}
+	if c.Label != other.Label {
+		diff["Label"] = [2]interface{}{c.Label, other.Label}
+	}
+	return diff
+}
+
 // equalInterface compares two interface{} values for equality.
 func equalInterface(a, b interface{}) bool {
 	aj, errA := json.Marshal(a)
@@ -368,8 +463,11 @@ func (c *IcePanelClient) ValidateLandscapeVersion(ctx context.Context, lc, ver s
 			log.Printf("Error closing response body: %v", cerr)
 		}
 	}()
-	if resp.StatusCode >= 300 {
-		return fmt.Errorf("landscape %s not found (status %s)", lc, resp.Status)
+	if err := checkResponse(resp); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("landscape %s not found: %w", lc, err)
+		}
+		return fmt.Errorf("failed to check landscape %s: %w", lc, err)
 	}
 	// Check version
 	url = fmt.Sprintf("%s/landscapes/%s/versions/%s", c.baseURL, lc, ver)
@@ -382,8 +480,11 @@ func (c *IcePanelClient) ValidateLandscapeVersion(ctx context.Context, lc, ver s
 			log.Printf("Error closing response body: %v", cerr)
 		}
 	}()
-	if resp.StatusCode >= 300 {
-		return fmt.Errorf("version %s not found in landscape %s (status %s)", ver, lc, resp.Status)
+	if err := checkResponse(resp); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("version %s not found in landscape %s: %w", ver, lc, err)
+		}
+		return fmt.Errorf("failed to check version %s: %w", ver, err)
 	}
 	return nil
 }
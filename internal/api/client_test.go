@@ -170,6 +170,35 @@ func TestIcePanelClient_WipeVersion(t *testing.T) {
 	}
 }
 
+func TestIcePanelClient_WipeTargets(t *testing.T) {
+	mockClient := &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			if req.Method != http.MethodGet {
+				t.Fatalf("WipeTargets() sent %s %s", req.Method, req.URL.Path)
+			}
+			if strings.HasSuffix(req.URL.Path, "/diagrams") {
+				return NewMockResponse(http.StatusOK, `{"data":[{"id":"d1"},{"id":"d2"}]}`), nil
+			}
+			return NewMockResponse(http.StatusOK, `{"data":[]}`), nil
+		},
+	}
+	client := &IcePanelClient{httpClient: mockClient, baseURL: "https://test.api.com"}
+
+	got, err := client.WipeTargets(context.Background(), "landscape1", "version1")
+	if err != nil {
+		t.Fatalf("WipeTargets() unexpected error = %v", err)
+	}
+	want := []WipeTarget{
+		{Path: "diagram-groups", IDs: []string{}},
+		{Path: "diagrams", IDs: []string{"d1", "d2"}},
+		{Path: "model/objects", IDs: []string{}},
+		{Path: "model/connections", IDs: []string{}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("WipeTargets() = %+v, want %+v", got, want)
+	}
+}
+
 func TestNewMockResponse(t *testing.T) {
 	resp := NewMockResponse(http.StatusOK, "test body")
 	if resp.StatusCode != http.StatusOK {
@@ -227,6 +256,12 @@ func TestObject_Equal(t *testing.T) {
 			b:    &Object{Name: "A", Desc: "desc", Type: "system", Props: map[string]interface{}{"foo": "baz"}},
 			want: false,
 		},
+		{
+			name: "different parent",
+			a:    &Object{Name: "A", Type: "system", Parent: "b1"},
+			b:    &Object{Name: "A", Type: "system", Parent: "b2"},
+			want: false,
+		},
 		{
 			name: "nil vs non-nil",
 			a:    nil,
@@ -387,3 +422,94 @@ func TestIcePanelClient_ValidateLandscapeVersion(t *testing.T) {
 		}
 	})
 }
+
+func TestIcePanelClient_Connections(t *testing.T) {
+	ctx := context.Background()
+
+	var gotMethods []string
+	mockClient := &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			gotMethods = append(gotMethods, req.Method+" "+req.URL.Path)
+			switch req.Method {
+			case http.MethodGet:
+				if strings.HasSuffix(req.URL.Path, "/h0001") {
+					return NewMockResponse(http.StatusOK, `{"handleId":"h0001","fromId":"a","toId":"b","name":"Calls"}`), nil
+				}
+				return NewMockResponse(http.StatusOK,
+					`{"data":[{"handleId":"h0001","fromId":"a","toId":"b","name":"Calls"}]}`), nil
+			case http.MethodPost, http.MethodPut:
+				return NewMockResponse(http.StatusOK, `{}`), nil
+			case http.MethodDelete:
+				return NewMockResponse(http.StatusNoContent, ""), nil
+			default:
+				return nil, fmt.Errorf("unexpected method: %s", req.Method)
+			}
+		},
+	}
+	client := &IcePanelClient{httpClient: mockClient, baseURL: "https://test.api.com"}
+
+	conns, err := client.ListConnections(ctx, "land1", "ver1")
+	if err != nil {
+		t.Fatalf("ListConnections() error = %v", err)
+	}
+	want := []*Connection{{Handle: "h0001", From: "a", To: "b", Label: "Calls"}}
+	if !reflect.DeepEqual(conns, want) {
+		t.Errorf("ListConnections() = %+v, want %+v", conns, want)
+	}
+	if err := client.CreateConnection(ctx, "land1", "ver1", want[0], false); err != nil {
+		t.Errorf("CreateConnection() error = %v", err)
+	}
+	if err := client.CreateConnection(ctx, "land1", "ver1", want[0], true); err != nil {
+		t.Errorf("CreateConnection() dry-run error = %v", err)
+	}
+	if err := client.UpdateConnection(ctx, "land1", "ver1", "h0001", want[0], false); err != nil {
+		t.Errorf("UpdateConnection() error = %v", err)
+	}
+	got, err := client.GetConnection(ctx, "land1", "ver1", "h0001")
+	if err != nil || !reflect.DeepEqual(got, want[0]) {
+		t.Errorf("GetConnection() = %+v, %v, want %+v", got, err, want[0])
+	}
+	if err := client.DeleteConnection(ctx, "land1", "ver1", "h0001"); err != nil {
+		t.Errorf("DeleteConnection() error = %v", err)
+	}
+
+	wantMethods := []string{
+		"GET /landscapes/land1/versions/ver1/model/connections",
+		"POST /landscapes/land1/versions/ver1/model/connections",
+		"PUT /landscapes/land1/versions/ver1/model/connections/h0001",
+		"GET /landscapes/land1/versions/ver1/model/connections/h0001",
+		"DELETE /landscapes/land1/versions/ver1/model/connections/h0001",
+	}
+	if !reflect.DeepEqual(gotMethods, wantMethods) {
+		t.Errorf("requests = %v, want %v", gotMethods, wantMethods)
+	}
+}
+
+func TestConnection_EqualAndDiff(t *testing.T) {
+	a := &Connection{Handle: "h1", From: "a", To: "b", Label: "Calls"}
+	b := &Connection{Handle: "h2", From: "a", To: "b", Label: "Calls"}
+	c := &Connection{Handle: "h1", From: "a", To: "c", Label: "Reads"}
+
+	if !a.Equal(b) {
+		t.Errorf("expected connections differing only by handle to be equal")
+	}
+	if a.Equal(c) || a.Equal(nil) {
+		t.Errorf("expected different connections not to be equal")
+	}
+	var n *Connection
+	if !n.Equal(nil) {
+		t.Errorf("expected nil connections to be equal")
+	}
+
+	if diff := a.Diff(b); len(diff) != 0 {
+		t.Errorf("Expected no diff, got %v", diff)
+	}
+	diff := a.Diff(c)
+	want := map[string][2]interface{}{"To": {"b", "c"}, "Label": {"Calls", "Reads"}}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("Diff() = %v, want %v", diff, want)
+	}
+	if diff := n.Diff(a); len(diff) != 1 || diff["nil"][1] != a {
+		t.Errorf("nil diff incorrect: %v", diff)
+	}
+}
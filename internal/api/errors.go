@@ -0,0 +1,142 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Sentinel errors matched by APIError for the status codes callers act on.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrRateLimited  = errors.New("rate limited")
+)
+
+// maxErrorBody caps how much of an error response is read.
+const maxErrorBody = 64 << 10
+
+// APIError is returned when IcePanel responds with a non-success status.
+// Use errors.As to inspect it, or errors.Is with ErrNotFound, ErrConflict,
+// ErrUnauthorized or ErrRateLimited to branch on the kind of failure.
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Status     string
+	Message    string   // message from the response body, if any
+	Details    []string // validation details from the response body, if any
+	RequestID  string
+}
+
+func (e *APIError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s: %s", e.Method, e.Path, e.Status)
+	if e.Message != "" {
+		fmt.Fprintf(&b, ": %s", e.Message)
+	}
+	if len(e.Details) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(e.Details, "; "))
+	}
+	if e.RequestID != "" {
+		fmt.Fprintf(&b, " [request %s]", e.RequestID)
+	}
+	return b.String()
+}
+
+// Is reports whether the error matches one of the sentinel errors.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// newAPIError builds an APIError from a failed response, decoding the body
+// when it is JSON. The caller remains responsible for closing the body.
+func newAPIError(resp *http.Response) *APIError {
+	e := &APIError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+	}
+	if e.Status == "" {
+		e.Status = fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	if req := resp.Request; req != nil {
+		e.Method = req.Method
+		e.Path = req.URL.Path
+	}
+	if resp.Header != nil {
+		e.RequestID = resp.Header.Get("X-Request-Id")
+	}
+	if resp.Body == nil {
+		return e
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if err != nil || len(body) == 0 {
+		return e
+	}
+
+	var out struct {
+		Message string            `json:"message"`
+		Error   json.RawMessage   `json:"error"`
+		Errors  []json.RawMessage `json:"errors"`
+		Details []json.RawMessage `json:"details"`
+	}
+	if json.Unmarshal(body, &out) != nil {
+		e.Message = strings.TrimSpace(string(body))
+		return e
+	}
+	e.Message = out.Message
+	if e.Message == "" {
+		e.Message = rawMessage(out.Error)
+	}
+	for _, d := range append(out.Errors, out.Details...) {
+		if m := rawMessage(d); m != "" {
+			e.Details = append(e.Details, m)
+		}
+	}
+	return e
+}
+
+// rawMessage extracts a readable message from a string or an object with
+// "message" and optional "path" fields.
+func rawMessage(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var obj struct {
+		Message string `json:"message"`
+		Path    any    `json:"path"`
+	}
+	if json.Unmarshal(raw, &obj) != nil {
+		return string(raw)
+	}
+	if obj.Path != nil && obj.Path != "" {
+		return fmt.Sprintf("%v: %s", obj.Path, obj.Message)
+	}
+	return obj.Message
+}
+
+// checkResponse returns an APIError for non-success responses.
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 300 {
+		return newAPIError(resp)
+	}
+	return nil
+}
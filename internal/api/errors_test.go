@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestNewAPIError(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		wantMessage string
+		wantDetails []string
+	}{
+		{
+			name:        "message and validation errors",
+			status:      http.StatusUnprocessableEntity,
+			body:        `{"message":"Validation failed","errors":[{"path":"name","message":"is required"},"bad type"]}`,
+			wantMessage: "Validation failed",
+			wantDetails: []string{"name: is required", "bad type"},
+		},
+		{
+			name:        "error field",
+			status:      http.StatusBadRequest,
+			body:        `{"error":"Bad request"}`,
+			wantMessage: "Bad request",
+		},
+		{
+			name:        "plain text body",
+			status:      http.StatusBadGateway,
+			body:        "upstream unavailable\n",
+			wantMessage: "upstream unavailable",
+		},
+		{
+			name:   "empty body",
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := NewMockResponse(tt.status, tt.body)
+			resp.Header.Set("X-Request-Id", "req-1")
+			resp.Request, _ = http.NewRequestWithContext(context.Background(), http.MethodPost,
+				"https://test.api.com/landscapes/l/versions/v/model/objects", nil)
+
+			e := newAPIError(resp)
+			if e.Method != http.MethodPost || e.Path != "/landscapes/l/versions/v/model/objects" {
+				t.Errorf("request context = %s %s", e.Method, e.Path)
+			}
+			if e.StatusCode != tt.status || e.RequestID != "req-1" {
+				t.Errorf("status = %d, request id = %q", e.StatusCode, e.RequestID)
+			}
+			if e.Message != tt.wantMessage {
+				t.Errorf("Message = %q, want %q", e.Message, tt.wantMessage)
+			}
+			if !reflect.DeepEqual(e.Details, tt.wantDetails) {
+				t.Errorf("Details = %v, want %v", e.Details, tt.wantDetails)
+			}
+		})
+	}
+}
+
+func TestAPIError_Is(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusNotFound, ErrNotFound},
+		{http.StatusConflict, ErrConflict},
+		{http.StatusUnauthorized, ErrUnauthorized},
+		{http.StatusForbidden, ErrUnauthorized},
+		{http.StatusTooManyRequests, ErrRateLimited},
+	}
+	sentinels := []error{ErrNotFound, ErrConflict, ErrUnauthorized, ErrRateLimited}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			err := fmt.Errorf("wrapped: %w", &APIError{StatusCode: tt.status})
+			for _, s := range sentinels {
+				if got := errors.Is(err, s); got != (s == tt.want) {
+					t.Errorf("errors.Is(%v) = %v", s, got)
+				}
+			}
+		})
+	}
+}
+
+func TestIcePanelClient_GetObject_APIError(t *testing.T) {
+	mockClient := &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			resp := NewMockResponse(http.StatusNotFound, `{"message":"Object not found"}`)
+			resp.Status = "404 Not Found"
+			return resp, nil
+		},
+	}
+	client := &IcePanelClient{httpClient: mockClient, baseURL: "https://test.api.com"}
+
+	_, err := client.GetObject(context.Background(), "land1", "ver1", "missing")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("GetObject() error = %v, want APIError", err)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound")
+	}
+	want := "GET /landscapes/land1/versions/ver1/model/objects/missing: 404 Not Found: Object not found"
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
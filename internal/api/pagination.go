@@ -0,0 +1,140 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"log"
+	"net/url"
+	"strconv"
+)
+
+// defaultPageSize is the number of items requested per page from list endpoints.
+const defaultPageSize = 1000
+
+// page is a single page of a list response. Endpoints that paginate by cursor
+// return NextCursor; otherwise pages are numbered and a short page is the last.
+type page[T any] struct {
+	Data       []T    `json:"data"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// paginate yields every item of a list endpoint, fetching pages on demand.
+// Iteration stops at the first error, which is yielded with a zero item.
+//
+// It also stops on an empty page, on a cursor it has already followed and on
+// a page that starts with the same item as the previous one, so a server that
+// ignores the page parameter or repeats a cursor cannot make it loop forever.
+func paginate[T any](ctx context.Context, c *IcePanelClient, endpoint string) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		per := c.pageSize
+		if per <= 0 {
+			per = defaultPageSize
+		}
+		cursor := ""
+		seen := make(map[string]bool)
+		var prevFirst []byte
+		for pageNum := 1; ; pageNum++ {
+			q := url.Values{}
+			q.Set("per", strconv.Itoa(per))
+			if cursor != "" {
+				q.Set("cursor", cursor)
+			} else {
+				q.Set("page", strconv.Itoa(pageNum))
+			}
+			p, err := fetchPage[T](ctx, c, endpoint+"?"+q.Encode())
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			if len(p.Data) == 0 {
+				return
+			}
+			first, err := json.Marshal(p.Data[0])
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			if bytes.Equal(first, prevFirst) {
+				return
+			}
+			prevFirst = first
+			for _, item := range p.Data {
+				if !yield(item, nil) {
+					return
+				}
+			}
+			switch {
+			case p.NextCursor != "" && !seen[p.NextCursor]:
+				seen[p.NextCursor] = true
+				cursor = p.NextCursor
+			case p.NextCursor != "", cursor != "", len(p.Data) < per:
+				return
+			}
+		}
+	}
+}
+
+func fetchPage[T any](ctx context.Context, c *IcePanelClient, url string) (*page[T], error) {
+	resp, err := c.call(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := resp.Body.Close(); cerr != nil {
+			log.Printf("Error closing response body: %v", cerr)
+		}
+	}()
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+	var p page[T]
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// collect drains an iterator into a slice, stopping at the first error.
+func collect[T any](seq iter.Seq2[T, error]) ([]T, error) {
+	var out []T
+	for item, err := range seq {
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, item)
+	}
+	return out, nil
+}
+
+func (c *IcePanelClient) versionURL(lc, ver, path string) string {
+	return fmt.Sprintf("%s/landscapes/%s/versions/%s/%s", c.baseURL, lc, ver, path)
+}
+
+// IterObjects yields every object in a landscape version, across all pages.
+func (c *IcePanelClient) IterObjects(ctx context.Context, lc, ver string) iter.Seq2[*Object, error] {
+	return paginate[*Object](ctx, c, c.versionURL(lc, ver, "model/objects"))
+}
+
+// IterConnections yields every connection in a landscape version, across all pages.
+func (c *IcePanelClient) IterConnections(ctx context.Context, lc, ver string) iter.Seq2[*Connection, error] {
+	return paginate[*Connection](ctx, c, c.versionURL(lc, ver, "model/connections"))
+}
+
+// IterIDs yields the ID of every item under a version path such as
+// "diagrams" or "diagram-groups", across all pages.
+func (c *IcePanelClient) IterIDs(ctx context.Context, lc, ver, path string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		type item struct {
+			ID string `json:"id"`
+		}
+		for it, err := range paginate[item](ctx, c, c.versionURL(lc, ver, path)) {
+			if !yield(it.ID, err) || err != nil {
+				return
+			}
+		}
+	}
+}
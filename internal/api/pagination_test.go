@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// pagedObjects serves n objects in pages of the requested size.
+func pagedObjects(n int, requests *[]string) *MockHTTPClient {
+	return &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			*requests = append(*requests, req.URL.RawQuery)
+			q := req.URL.Query()
+			per, _ := strconv.Atoi(q.Get("per"))
+			pageNum, _ := strconv.Atoi(q.Get("page"))
+			var items []string
+			for i := (pageNum - 1) * per; i < n && i < pageNum*per; i++ {
+				items = append(items, fmt.Sprintf(`{"handleId":"o%d"}`, i))
+			}
+			return NewMockResponse(http.StatusOK, `{"data":[`+strings.Join(items, ",")+`]}`), nil
+		},
+	}
+}
+
+func TestIcePanelClient_ListObjects_Pages(t *testing.T) {
+	var requests []string
+	client := &IcePanelClient{httpClient: pagedObjects(5, &requests), baseURL: "https://test.api.com", pageSize: 2}
+
+	objs, err := client.ListObjects(context.Background(), "land1", "ver1")
+	if err != nil {
+		t.Fatalf("ListObjects() error = %v", err)
+	}
+	if len(objs) != 5 || objs[4].Handle != "o4" {
+		t.Errorf("ListObjects() returned %d objects, want 5", len(objs))
+	}
+	want := []string{"page=1&per=2", "page=2&per=2", "page=3&per=2"}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("requests = %v, want %v", requests, want)
+	}
+}
+
+func TestIcePanelClient_IterObjects_StopEarly(t *testing.T) {
+	var requests []string
+	client := &IcePanelClient{httpClient: pagedObjects(10, &requests), baseURL: "https://test.api.com", pageSize: 2}
+
+	n := 0
+	for _, err := range client.IterObjects(context.Background(), "land1", "ver1") {
+		if err != nil {
+			t.Fatalf("IterObjects() error = %v", err)
+		}
+		n++
+		if n == 3 {
+			break
+		}
+	}
+	if len(requests) != 2 {
+		t.Errorf("made %d requests, want 2", len(requests))
+	}
+}
+
+func TestIcePanelClient_IterConnections_Cursor(t *testing.T) {
+	pages := map[string]string{
+		"":    `{"data":[{"handleId":"c1"}],"nextCursor":"abc"}`,
+		"abc": `{"data":[{"handleId":"c2"}],"nextCursor":"def"}`,
+		"def": `{"data":[{"handleId":"c3"}]}`,
+	}
+	mockClient := &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			return NewMockResponse(http.StatusOK, pages[req.URL.Query().Get("cursor")]), nil
+		},
+	}
+	client := &IcePanelClient{httpClient: mockClient, baseURL: "https://test.api.com"}
+
+	conns, err := client.ListConnections(context.Background(), "land1", "ver1")
+	if err != nil {
+		t.Fatalf("ListConnections() error = %v", err)
+	}
+	var got []string
+	for _, c := range conns {
+		got = append(got, c.Handle)
+	}
+	if !reflect.DeepEqual(got, []string{"c1", "c2", "c3"}) {
+		t.Errorf("ListConnections() = %v, want [c1 c2 c3]", got)
+	}
+}
+
+func TestIcePanelClient_ListObjects_Terminates(t *testing.T) {
+	tests := []struct {
+		name  string
+		pages map[string]string // response body by page number or cursor
+		want  []string
+	}{
+		{
+			name: "empty page",
+			pages: map[string]string{
+				"1": `{"data":[{"handleId":"o1"},{"handleId":"o2"}]}`,
+				"2": `{"data":[]}`,
+			},
+			want: []string{"o1", "o2"},
+		},
+		{
+			name: "page parameter ignored",
+			pages: map[string]string{
+				"1": `{"data":[{"handleId":"o1"},{"handleId":"o2"},{"handleId":"o3"}]}`,
+				"2": `{"data":[{"handleId":"o1"},{"handleId":"o2"},{"handleId":"o3"}]}`,
+			},
+			want: []string{"o1", "o2", "o3"},
+		},
+		{
+			name: "repeated cursor",
+			pages: map[string]string{
+				"1":   `{"data":[{"handleId":"o1"}],"nextCursor":"abc"}`,
+				"abc": `{"data":[{"handleId":"o2"}],"nextCursor":"def"}`,
+				"def": `{"data":[{"handleId":"o3"}],"nextCursor":"abc"}`,
+			},
+			want: []string{"o1", "o2", "o3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			mockClient := &MockHTTPClient{
+				DoFunc: func(req *http.Request) (*http.Response, error) {
+					if requests++; requests > 10 {
+						t.Fatal("pagination did not stop")
+					}
+					q := req.URL.Query()
+					return NewMockResponse(http.StatusOK, tt.pages[q.Get("cursor")+q.Get("page")]), nil
+				},
+			}
+			client := &IcePanelClient{httpClient: mockClient, baseURL: "https://test.api.com", pageSize: 2}
+
+			objs, err := client.ListObjects(context.Background(), "land1", "ver1")
+			if err != nil {
+				t.Fatalf("ListObjects() error = %v", err)
+			}
+			var got []string
+			for _, o := range objs {
+				got = append(got, o.Handle)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListObjects() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIcePanelClient_IterIDs_Error(t *testing.T) {
+	calls := 0
+	mockClient := &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			calls++
+			if calls == 2 {
+				return &http.Response{
+					StatusCode: http.StatusBadGateway,
+					Status:     "502 Bad Gateway",
+					Body:       NewMockResponse(0, "").Body,
+				}, nil
+			}
+			return NewMockResponse(http.StatusOK, `{"data":[{"id":"d1"},{"id":"d2"}]}`), nil
+		},
+	}
+	client := &IcePanelClient{httpClient: mockClient, baseURL: "https://test.api.com", pageSize: 2}
+
+	ids, err := client.listIDs(context.Background(), "land1", "ver1", "diagrams")
+	if err == nil || !strings.Contains(err.Error(), "502") {
+		t.Errorf("listIDs() = %v, %v, want 502 error", ids, err)
+	}
+}
+
+func TestIcePanelClient_WipeVersion_AllPages(t *testing.T) {
+	var deleted []string
+	mockClient := &MockHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			if req.Method == http.MethodDelete {
+				deleted = append(deleted, req.URL.Path)
+				return NewMockResponse(http.StatusNoContent, ""), nil
+			}
+			if !strings.HasSuffix(req.URL.Path, "/model/objects") {
+				return NewMockResponse(http.StatusOK, `{"data":[]}`), nil
+			}
+			if req.URL.Query().Get("page") == "1" {
+				return NewMockResponse(http.StatusOK, `{"data":[{"id":"o1"},{"id":"o2"}]}`), nil
+			}
+			return NewMockResponse(http.StatusOK, `{"data":[{"id":"o3"}]}`), nil
+		},
+	}
+	client := &IcePanelClient{httpClient: mockClient, baseURL: "https://test.api.com", pageSize: 2}
+
+	if err := client.WipeVersion(context.Background(), "land1", "ver1"); err != nil {
+		t.Fatalf("WipeVersion() error = %v", err)
+	}
+	if len(deleted) != 3 {
+		t.Errorf("deleted %v, want 3 objects", deleted)
+	}
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"mermaid-icepanel/internal/config"
+)
+
+// RetryingHTTPClient wraps an HTTPClient and retries requests that failed for
+// transient reasons, backing off exponentially with jitter between attempts.
+//
+// Idempotent methods are retried on network errors and 502/503/504 responses.
+// Any method is retried on 429, since the server did not process the request.
+// A Retry-After header, when present, replaces the computed backoff.
+type RetryingHTTPClient struct {
+	Next   HTTPClient
+	Policy config.RetryPolicy
+
+	// sleep waits for d or until ctx is done; replaced in tests.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewRetryingHTTPClient creates a retrying client around next.
+func NewRetryingHTTPClient(next HTTPClient, policy config.RetryPolicy) *RetryingHTTPClient {
+	return &RetryingHTTPClient{Next: next, Policy: policy, sleep: sleepContext}
+}
+
+// Do executes the request, retrying it according to the policy.
+func (c *RetryingHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := c.Next.Do(req)
+		if attempt >= c.Policy.MaxRetries || !c.shouldRetry(req, resp, err) {
+			return resp, err
+		}
+
+		delay := c.backoff(attempt)
+		if resp != nil {
+			if ra, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+				delay = ra
+			}
+			discard(resp)
+		}
+		log.Printf("Retrying %s %s in %v (attempt %d of %d)", req.Method, req.URL.Path, delay,
+			attempt+1, c.Policy.MaxRetries)
+		sleep := c.sleep
+		if sleep == nil {
+			sleep = sleepContext
+		}
+		if err := sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+
+		if req.Body != nil && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+func (c *RetryingHTTPClient) shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	// A consumed body cannot be sent again.
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	if err != nil {
+		return isIdempotent(req.Method)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return isIdempotent(req.Method)
+	}
+	return false
+}
+
+// backoff returns a random delay in [0, min(MaxDelay, BaseDelay*2^attempt)).
+func (c *RetryingHTTPClient) backoff(attempt int) time.Duration {
+	ceiling := c.Policy.BaseDelay << attempt
+	if ceiling <= 0 || (c.Policy.MaxDelay > 0 && ceiling > c.Policy.MaxDelay) {
+		ceiling = c.Policy.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling) //nolint:gosec // jitter does not need a secure source
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func retryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// discard drains and closes a response that is about to be retried.
+func discard(resp *http.Response) {
+	if resp.Body == nil {
+		return
+	}
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		log.Printf("Error draining response body: %v", err)
+	}
+	if cerr := resp.Body.Close(); cerr != nil {
+		log.Printf("Error closing response body: %v", cerr)
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
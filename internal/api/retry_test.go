@@ -0,0 +1,188 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"mermaid-icepanel/internal/config"
+)
+
+// scriptedClient returns the scripted responses in order and records request bodies.
+type scriptedClient struct {
+	responses []*http.Response
+	errs      []error
+	bodies    []string
+}
+
+func (s *scriptedClient) Do(req *http.Request) (*http.Response, error) {
+	i := len(s.bodies)
+	var b []byte
+	if req.Body != nil {
+		b, _ = io.ReadAll(req.Body)
+	}
+	s.bodies = append(s.bodies, string(b))
+	if i < len(s.errs) && s.errs[i] != nil {
+		return nil, s.errs[i]
+	}
+	return s.responses[i], nil
+}
+
+func newTestRetryClient(next HTTPClient, slept *[]time.Duration) *RetryingHTTPClient {
+	c := NewRetryingHTTPClient(next, config.RetryPolicy{
+		MaxRetries: 2,
+		BaseDelay:  100 * time.Millisecond,
+		MaxDelay:   time.Second,
+	})
+	c.sleep = func(_ context.Context, d time.Duration) error {
+		*slept = append(*slept, d)
+		return nil
+	}
+	return c
+}
+
+func withHeader(resp *http.Response, key, value string) *http.Response {
+	resp.Header.Set(key, value)
+	return resp
+}
+
+func TestRetryingHTTPClient(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		responses  []*http.Response
+		errs       []error
+		wantStatus int
+		wantCalls  int
+		wantErr    bool
+	}{
+		{
+			name:       "GET retried on 503",
+			method:     http.MethodGet,
+			responses:  []*http.Response{NewMockResponse(503, ""), NewMockResponse(200, "ok")},
+			wantStatus: 200,
+			wantCalls:  2,
+		},
+		{
+			name:       "POST not retried on 502",
+			method:     http.MethodPost,
+			responses:  []*http.Response{NewMockResponse(502, "")},
+			wantStatus: 502,
+			wantCalls:  1,
+		},
+		{
+			name:       "POST retried on 429",
+			method:     http.MethodPost,
+			responses:  []*http.Response{NewMockResponse(429, ""), NewMockResponse(201, "")},
+			wantStatus: 201,
+			wantCalls:  2,
+		},
+		{
+			name:   "DELETE retried on network error",
+			method: http.MethodDelete,
+			responses: []*http.Response{
+				nil, NewMockResponse(204, ""),
+			},
+			errs:       []error{errors.New("connection reset")},
+			wantStatus: 204,
+			wantCalls:  2,
+		},
+		{
+			name:   "gives up after max retries",
+			method: http.MethodGet,
+			responses: []*http.Response{
+				NewMockResponse(504, ""), NewMockResponse(504, ""), NewMockResponse(504, ""),
+			},
+			wantStatus: 504,
+			wantCalls:  3,
+		},
+		{
+			name:       "client errors are not retried",
+			method:     http.MethodGet,
+			responses:  []*http.Response{NewMockResponse(404, "")},
+			wantStatus: 404,
+			wantCalls:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := &scriptedClient{responses: tt.responses, errs: tt.errs}
+			var slept []time.Duration
+			client := newTestRetryClient(next, &slept)
+
+			req, err := http.NewRequestWithContext(context.Background(), tt.method,
+				"https://test.api.com/x", bytes.NewReader([]byte(`{"a":1}`)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Do(req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if len(next.bodies) != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", len(next.bodies), tt.wantCalls)
+			}
+			for i, b := range next.bodies {
+				if b != `{"a":1}` {
+					t.Errorf("attempt %d sent body %q", i, b)
+				}
+			}
+			for _, d := range slept {
+				if d < 0 || d > time.Second {
+					t.Errorf("backoff %v outside [0, 1s]", d)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryingHTTPClient_RetryAfter(t *testing.T) {
+	next := &scriptedClient{responses: []*http.Response{
+		withHeader(NewMockResponse(429, ""), "Retry-After", "7"),
+		NewMockResponse(200, ""),
+	}}
+	var slept []time.Duration
+	client := newTestRetryClient(next, &slept)
+
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "https://test.api.com/x", nil)
+	if _, err := client.Do(req); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if !reflect.DeepEqual(slept, []time.Duration{7 * time.Second}) {
+		t.Errorf("slept %v, want [7s]", slept)
+	}
+}
+
+func TestRetryingHTTPClient_ContextCanceled(t *testing.T) {
+	next := &scriptedClient{responses: []*http.Response{NewMockResponse(503, ""), NewMockResponse(200, "")}}
+	client := NewRetryingHTTPClient(next, config.RetryPolicy{MaxRetries: 3, BaseDelay: time.Hour, MaxDelay: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://test.api.com/x", nil)
+	if _, err := client.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Do() error = %v, want deadline exceeded", err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	if d, ok := retryAfter("3"); !ok || d != 3*time.Second {
+		t.Errorf("retryAfter(3) = %v, %v", d, ok)
+	}
+	future := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if d, ok := retryAfter(future); !ok || d <= 0 || d > time.Minute {
+		t.Errorf("retryAfter(date) = %v, %v", d, ok)
+	}
+	if _, ok := retryAfter("soon"); ok {
+		t.Errorf("retryAfter(soon) should not parse")
+	}
+}
@@ -1,41 +1,192 @@
-// Package config handles application configuration with environment variable support.
+// Package config handles application configuration from environment variables
+// and named profiles in config files.
 package config
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
+	"strconv"
 	"time"
 )
 
 // Config holds application configuration with defaults from environment variables.
 type Config struct {
 	APIBaseURL     string
-	RequestTimeout time.Duration
+	RequestTimeout time.Duration // limit for a single HTTP request, including reading the response
+	RunTimeout     time.Duration // limit for a whole command or upload; 0 means no limit
 	DefaultToken   string
+	Retry          RetryPolicy
+	Concurrency    int // parallel requests for bulk create, update and delete
+
+	// Defaults for command line flags, from ICEPANEL_LANDSCAPE, ICEPANEL_VERSION
+	// and ICEPANEL_DIAGRAM_NAME or the selected profile.
+	LandscapeID string
+	VersionID   string
+	DiagramName string
+	Classifier  Classifier
+}
+
+// RetryPolicy controls how failed API requests are retried.
+type RetryPolicy struct {
+	MaxRetries int           // retries after the first attempt; 0 disables retrying
+	BaseDelay  time.Duration // backoff before the first retry, doubled on each attempt
+	MaxDelay   time.Duration // upper bound for a single backoff; 0 means no bound
 }
 
 // NewConfig creates a Config with values from environment or defaults.
+// Invalid values are ignored; use Load to have them reported.
 func NewConfig() *Config {
+	return new(loader).env(defaults())
+}
+
+// Load creates a Config from the named profile (see LoadProfile). Environment
+// variables take precedence over the profile, which takes precedence over
+// the defaults. Every invalid setting is reported in the returned error.
+func Load(profile string) (*Config, error) {
+	p, err := LoadProfile(profile)
+	if err != nil {
+		return nil, err
+	}
+	l := new(loader)
+	base := defaults()
+	if p.APIURL != "" {
+		base.APIBaseURL = p.APIURL
+	}
+	if base.DefaultToken, err = p.token(); err != nil {
+		l.errs = append(l.errs, err)
+	}
+	base.RequestTimeout = l.duration("profile timeout", p.Timeout, base.RequestTimeout, time.Nanosecond)
+	base.RunTimeout = l.duration("profile run_timeout", p.RunTimeout, base.RunTimeout, 0)
+	base.LandscapeID = p.Landscape
+	base.VersionID = p.Version
+	base.DiagramName = p.DiagramName
+	base.Classifier = p.Classifier
+
+	cfg := l.env(base)
+	if err := cfg.Validate(); err != nil {
+		l.errs = append(l.errs, err)
+	}
+	if len(l.errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration:\n%w", errors.Join(l.errs...))
+	}
+	return cfg, nil
+}
+
+// Validate checks the settings that depend on more than one value or are not
+// checked while loading, reporting every problem found.
+func (c *Config) Validate() error {
+	var errs []error
+	if u, err := url.Parse(c.APIBaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("invalid API URL %q: want an absolute http or https URL", c.APIBaseURL))
+	}
+	if c.RequestTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("invalid request timeout %s: want a positive duration", c.RequestTimeout))
+	}
+	if c.RunTimeout < 0 {
+		errs = append(errs, fmt.Errorf("invalid run timeout %s: want 0 or a positive duration", c.RunTimeout))
+	}
+	if c.Retry.MaxDelay > 0 && c.Retry.MaxDelay < c.Retry.BaseDelay {
+		errs = append(errs, fmt.Errorf("retry max delay %s is shorter than the base delay %s",
+			c.Retry.MaxDelay, c.Retry.BaseDelay))
+	}
+	if c.Concurrency < 1 {
+		errs = append(errs, fmt.Errorf("invalid concurrency %d: want at least 1", c.Concurrency))
+	}
+	return errors.Join(errs...)
+}
+
+// ParseDuration parses whole seconds ("30") or a Go duration ("30s", "1m30s").
+func ParseDuration(s string) (time.Duration, error) {
+	if secs, err := strconv.Atoi(s); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func defaults() *Config {
 	return &Config{
-		APIBaseURL:     getEnvOr("ICEPANEL_API_URL", "https://api.icepanel.io/v1"),
-		RequestTimeout: time.Duration(getEnvIntOr("ICEPANEL_TIMEOUT_SECONDS", 30)) * time.Second,
-		DefaultToken:   os.Getenv("ICEPANEL_TOKEN"),
+		APIBaseURL:     "https://api.icepanel.io/v1",
+		RequestTimeout: 30 * time.Second,
+		RunTimeout:     10 * time.Minute,
+		Retry: RetryPolicy{
+			MaxRetries: 3,
+			BaseDelay:  500 * time.Millisecond,
+			MaxDelay:   30 * time.Second,
+		},
+		Concurrency: 8,
 	}
 }
 
-// Helper function to get environment variable with default.
-func getEnvOr(key, defaultValue string) string {
-	if value, exists := os.LookupEnv(key); exists && value != "" {
-		return value
+// loader parses typed settings, collecting every invalid value so that they
+// can be reported together. An invalid value leaves the default in place.
+type loader struct {
+	errs []error
+}
+
+// env returns base with any settings given in the environment applied.
+func (l *loader) env(base *Config) *Config {
+	return &Config{
+		APIBaseURL:     getEnvOr("ICEPANEL_API_URL", base.APIBaseURL),
+		RequestTimeout: l.envDuration("ICEPANEL_TIMEOUT_SECONDS", base.RequestTimeout, time.Nanosecond),
+		RunTimeout:     l.envDuration("ICEPANEL_RUN_TIMEOUT", base.RunTimeout, 0),
+		DefaultToken:   getEnvOr("ICEPANEL_TOKEN", base.DefaultToken),
+		Retry: RetryPolicy{
+			MaxRetries: l.envCount("ICEPANEL_MAX_RETRIES", base.Retry.MaxRetries, 0),
+			BaseDelay:  l.envDuration("ICEPANEL_RETRY_BASE_DELAY", base.Retry.BaseDelay, 0),
+			MaxDelay:   l.envDuration("ICEPANEL_RETRY_MAX_DELAY", base.Retry.MaxDelay, 0),
+		},
+		Concurrency: l.envCount("ICEPANEL_CONCURRENCY", base.Concurrency, 1),
+		LandscapeID: getEnvOr("ICEPANEL_LANDSCAPE", base.LandscapeID),
+		VersionID:   getEnvOr("ICEPANEL_VERSION", base.VersionID),
+		DiagramName: getEnvOr("ICEPANEL_DIAGRAM_NAME", base.DiagramName),
+		Classifier:  base.Classifier,
 	}
-	return defaultValue
 }
 
-// Helper function to get environment variable as int with default.
-func getEnvIntOr(key string, defaultValue int) int {
-	if value, exists := os.LookupEnv(key); exists && value != "" {
-		if intVal, err := time.ParseDuration(value); err == nil {
-			return int(intVal)
+func (l *loader) envDuration(key string, def, minimum time.Duration) time.Duration {
+	return l.duration(key, os.Getenv(key), def, minimum)
+}
+
+func (l *loader) envCount(key string, def, minimum int) int {
+	return l.count(key, os.Getenv(key), def, minimum)
+}
+
+// duration parses value with ParseDuration, returning def if it is empty.
+func (l *loader) duration(name, value string, def, minimum time.Duration) time.Duration {
+	if value == "" {
+		return def
+	}
+	d, err := ParseDuration(value)
+	if err != nil || d < minimum {
+		want := "whole seconds or a duration such as 45s"
+		if minimum > 0 {
+			want = "positive " + want
 		}
+		l.errs = append(l.errs, fmt.Errorf("invalid %s %q: want %s", name, value, want))
+		return def
+	}
+	return d
+}
+
+// count parses value as an integer of at least minimum, returning def if it is empty.
+func (l *loader) count(name, value string, def, minimum int) int {
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < minimum {
+		l.errs = append(l.errs, fmt.Errorf("invalid %s %q: want an integer of at least %d", name, value, minimum))
+		return def
+	}
+	return n
+}
+
+// Helper function to get environment variable with default.
+func getEnvOr(key, defaultValue string) string {
+	if value, exists := os.LookupEnv(key); exists && value != "" {
+		return value
 	}
 	return defaultValue
 }
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -113,3 +114,85 @@ func TestGetEnvOr(t *testing.T) {
 		})
 	}
 }
+
+func TestRetryPolicyFromEnvironment(t *testing.T) {
+	t.Setenv("ICEPANEL_MAX_RETRIES", "5")
+	t.Setenv("ICEPANEL_RETRY_BASE_DELAY", "250ms")
+	t.Setenv("ICEPANEL_RETRY_MAX_DELAY", "bogus")
+
+	cfg := NewConfig()
+	want := RetryPolicy{MaxRetries: 5, BaseDelay: 250 * time.Millisecond, MaxDelay: 30 * time.Second}
+	if cfg.Retry != want {
+		t.Errorf("Retry = %+v, want %+v", cfg.Retry, want)
+	}
+}
+
+func TestLoad_UncappedRetryDelay(t *testing.T) {
+	clearEnv(t)
+	writeConfigs(t, "", "")
+	t.Setenv("ICEPANEL_RETRY_BASE_DELAY", "1m")
+	t.Setenv("ICEPANEL_RETRY_MAX_DELAY", "0")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v, want a max delay of 0 to mean no bound", err)
+	}
+	if cfg.Retry.MaxDelay != 0 {
+		t.Errorf("Retry.MaxDelay = %v, want 0", cfg.Retry.MaxDelay)
+	}
+}
+
+func TestTimeoutsFromEnvironment(t *testing.T) {
+	tests := []struct {
+		name        string
+		timeout     string
+		runTimeout  string
+		wantRequest time.Duration
+		wantRun     time.Duration
+	}{
+		{name: "defaults", wantRequest: 30 * time.Second, wantRun: 10 * time.Minute},
+		{name: "whole seconds", timeout: "45", runTimeout: "600", wantRequest: 45 * time.Second, wantRun: 10 * time.Minute},
+		{name: "durations", timeout: "45s", runTimeout: "1h", wantRequest: 45 * time.Second, wantRun: time.Hour},
+		{name: "no run limit", runTimeout: "0", wantRequest: 30 * time.Second, wantRun: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ICEPANEL_TIMEOUT_SECONDS", tt.timeout)
+			t.Setenv("ICEPANEL_RUN_TIMEOUT", tt.runTimeout)
+			cfg := NewConfig()
+			if cfg.RequestTimeout != tt.wantRequest || cfg.RunTimeout != tt.wantRun {
+				t.Errorf("RequestTimeout, RunTimeout = %v, %v, want %v, %v",
+					cfg.RequestTimeout, cfg.RunTimeout, tt.wantRequest, tt.wantRun)
+			}
+		})
+	}
+}
+
+func TestLoad_ReportsAllInvalidSettings(t *testing.T) {
+	clearEnv(t)
+	writeConfigs(t, "", "profiles:\n  p:\n    timeout: soon\n    run_timeout: -1m\n")
+	t.Setenv("ICEPANEL_API_URL", "api.example.com")
+	t.Setenv("ICEPANEL_TIMEOUT_SECONDS", "30x")
+	t.Setenv("ICEPANEL_MAX_RETRIES", "-1")
+	t.Setenv("ICEPANEL_RETRY_BASE_DELAY", "1m")
+	t.Setenv("ICEPANEL_CONCURRENCY", "0")
+
+	_, err := Load("p")
+	if err == nil {
+		t.Fatal("Load() error = nil, want invalid settings")
+	}
+	for _, want := range []string{
+		`invalid profile timeout "soon"`,
+		`invalid profile run_timeout "-1m"`,
+		`invalid ICEPANEL_TIMEOUT_SECONDS "30x"`,
+		`invalid ICEPANEL_MAX_RETRIES "-1"`,
+		`invalid ICEPANEL_CONCURRENCY "0"`,
+		`invalid API URL "api.example.com"`,
+		"retry max delay 30s is shorter than the base delay 1m0s",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Load() error = %v\nwant it to contain %q", err, want)
+		}
+	}
+}
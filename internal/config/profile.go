@@ -0,0 +1,186 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectFile is the project-local config file, read from the working directory.
+const ProjectFile = ".icepanel.yaml"
+
+// File is a config file holding named profiles.
+//
+//	default_profile: tdd
+//	profiles:
+//	  tdd:
+//	    api_url: https://api.icepanel.io/v1
+//	    token_env: ICEPANEL_TDD_TOKEN
+//	    landscape: abc123
+//	    version: latest
+//	    timeout: 45s
+//	    run_timeout: 15m
+//	    diagram_name: TDD services
+//	    classifier:
+//	      external_patterns: [Gateway, Partner]
+//	      database_patterns: [Store]
+type File struct {
+	DefaultProfile string              `yaml:"default_profile"`
+	Profiles       map[string]*Profile `yaml:"profiles"`
+}
+
+// Profile holds the settings for one landscape or environment. Empty fields
+// leave the defaults (or the user-level profile of the same name) in place.
+type Profile struct {
+	APIURL      string     `yaml:"api_url"`
+	Token       string     `yaml:"token"`      // literal token; prefer token_env or token_file
+	TokenEnv    string     `yaml:"token_env"`  // environment variable holding the token
+	TokenFile   string     `yaml:"token_file"` // file holding the token; ~ expands to the home directory
+	Landscape   string     `yaml:"landscape"`
+	Version     string     `yaml:"version"`
+	Timeout     string     `yaml:"timeout"`     // per request; Go duration such as 45s, or whole seconds
+	RunTimeout  string     `yaml:"run_timeout"` // whole command or upload; 0 means no limit
+	DiagramName string     `yaml:"diagram_name"`
+	Classifier  Classifier `yaml:"classifier"`
+}
+
+// Classifier holds the naming patterns used to classify proto services.
+type Classifier struct {
+	ExternalPatterns []string `yaml:"external_patterns"`
+	DatabasePatterns []string `yaml:"database_patterns"`
+}
+
+// Files returns the config files that are read, lowest precedence first:
+// the user-level file, then the project file. ICEPANEL_CONFIG replaces both.
+func Files() []string {
+	if path := os.Getenv("ICEPANEL_CONFIG"); path != "" {
+		return []string{path}
+	}
+	var files []string
+	if dir, err := os.UserConfigDir(); err == nil {
+		files = append(files, filepath.Join(dir, "icepanel", "config.yaml"))
+	}
+	return append(files, ProjectFile)
+}
+
+// LoadProfile reads the config files and returns the named profile, merged
+// field by field with later files taking precedence. An empty name selects
+// ICEPANEL_PROFILE, then default_profile; if neither is set, an empty profile
+// is returned. Naming a profile that no file defines is an error.
+func LoadProfile(name string) (*Profile, error) {
+	merged := &File{Profiles: make(map[string]*Profile)}
+	for _, path := range Files() {
+		f, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if f == nil {
+			continue
+		}
+		if f.DefaultProfile != "" {
+			merged.DefaultProfile = f.DefaultProfile
+		}
+		for n, p := range f.Profiles {
+			if p == nil {
+				p = &Profile{}
+			}
+			if base, ok := merged.Profiles[n]; ok {
+				p = base.merge(p)
+			}
+			merged.Profiles[n] = p
+		}
+	}
+
+	if name == "" {
+		name = getEnvOr("ICEPANEL_PROFILE", merged.DefaultProfile)
+	}
+	if name == "" {
+		return &Profile{}, nil
+	}
+	p, ok := merged.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(merged.Profiles))
+		for n := range merged.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("profile %q not found in %s (available: %s)",
+			name, strings.Join(Files(), ", "), strings.Join(names, ", "))
+	}
+	return p, nil
+}
+
+// readFile parses a config file, returning nil if it does not exist.
+func readFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var f File
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return &f, nil
+}
+
+// merge returns p with the non-empty fields of over applied on top.
+func (p *Profile) merge(over *Profile) *Profile {
+	out := *p
+	for _, f := range []struct{ dst, src *string }{
+		{&out.APIURL, &over.APIURL},
+		{&out.Token, &over.Token},
+		{&out.TokenEnv, &over.TokenEnv},
+		{&out.TokenFile, &over.TokenFile},
+		{&out.Landscape, &over.Landscape},
+		{&out.Version, &over.Version},
+		{&out.Timeout, &over.Timeout},
+		{&out.RunTimeout, &over.RunTimeout},
+		{&out.DiagramName, &over.DiagramName},
+	} {
+		if *f.src != "" {
+			*f.dst = *f.src
+		}
+	}
+	if len(over.Classifier.ExternalPatterns) > 0 {
+		out.Classifier.ExternalPatterns = over.Classifier.ExternalPatterns
+	}
+	if len(over.Classifier.DatabasePatterns) > 0 {
+		out.Classifier.DatabasePatterns = over.Classifier.DatabasePatterns
+	}
+	return &out
+}
+
+// token resolves the profile's token from its literal value, environment
+// variable or file, in that order.
+func (p *Profile) token() (string, error) {
+	switch {
+	case p.Token != "":
+		return p.Token, nil
+	case p.TokenEnv != "":
+		return os.Getenv(p.TokenEnv), nil
+	case p.TokenFile != "":
+		path := p.TokenFile
+		if rest, ok := strings.CutPrefix(path, "~/"); ok {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", fmt.Errorf("failed to expand token_file: %w", err)
+			}
+			path = filepath.Join(home, rest)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read token_file: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const userConfig = `
+default_profile: dev
+profiles:
+  dev:
+    api_url: https://dev.example.com/v1
+    token_env: DEV_TOKEN
+    landscape: dev-landscape
+    version: dev-version
+    classifier:
+      external_patterns: [Partner]
+  tdd:
+    token_file: %s
+    landscape: tdd-landscape
+    timeout: "45"
+    run_timeout: "0"
+`
+
+const projectConfig = `
+profiles:
+  dev:
+    version: project-version
+    timeout: 1m
+    diagram_name: Dev services
+    classifier:
+      database_patterns: [Store]
+`
+
+// writeConfigs writes the user-level and project config files and makes the
+// test use them.
+func writeConfigs(t *testing.T, user, project string) {
+	t.Helper()
+	userDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", userDir)
+	t.Setenv("ICEPANEL_CONFIG", "")
+	t.Setenv("ICEPANEL_PROFILE", "")
+	if user != "" {
+		if err := os.MkdirAll(filepath.Join(userDir, "icepanel"), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(userDir, "icepanel", "config.yaml"), []byte(user), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	projectDir := t.TempDir()
+	t.Chdir(projectDir)
+	if project != "" {
+		if err := os.WriteFile(filepath.Join(projectDir, ProjectFile), []byte(project), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, key := range []string{
+		"ICEPANEL_API_URL", "ICEPANEL_TOKEN", "ICEPANEL_TIMEOUT_SECONDS", "ICEPANEL_RUN_TIMEOUT",
+		"ICEPANEL_MAX_RETRIES", "ICEPANEL_RETRY_BASE_DELAY", "ICEPANEL_RETRY_MAX_DELAY", "ICEPANEL_CONCURRENCY",
+		"ICEPANEL_LANDSCAPE", "ICEPANEL_VERSION", "ICEPANEL_DIAGRAM_NAME",
+	} {
+		t.Setenv(key, "")
+	}
+}
+
+func TestLoad_Profiles(t *testing.T) {
+	clearEnv(t)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("file-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	writeConfigs(t, strings.Replace(userConfig, "%s", tokenFile, 1), projectConfig)
+	t.Setenv("DEV_TOKEN", "dev-token")
+
+	tests := []struct {
+		name    string
+		profile string
+		env     map[string]string
+		want    Config
+	}{
+		{
+			name: "default profile merged across files",
+			want: Config{
+				APIBaseURL: "https://dev.example.com/v1", RequestTimeout: time.Minute, RunTimeout: 10 * time.Minute,
+				DefaultToken: "dev-token", LandscapeID: "dev-landscape", VersionID: "project-version", DiagramName: "Dev services",
+				Classifier: Classifier{ExternalPatterns: []string{"Partner"}, DatabasePatterns: []string{"Store"}},
+			},
+		},
+		{
+			name:    "named profile with token file, timeout in seconds and no run timeout",
+			profile: "tdd",
+			want: Config{
+				APIBaseURL: "https://api.icepanel.io/v1", RequestTimeout: 45 * time.Second, DefaultToken: "file-token",
+				LandscapeID: "tdd-landscape",
+			},
+		},
+		{
+			name:    "profile from environment",
+			profile: "",
+			env:     map[string]string{"ICEPANEL_PROFILE": "tdd"},
+			want: Config{
+				APIBaseURL: "https://api.icepanel.io/v1", RequestTimeout: 45 * time.Second, DefaultToken: "file-token",
+				LandscapeID: "tdd-landscape",
+			},
+		},
+		{
+			name:    "environment overrides profile",
+			profile: "dev",
+			env: map[string]string{
+				"ICEPANEL_API_URL": "https://env.example.com", "ICEPANEL_TOKEN": "env-token",
+				"ICEPANEL_LANDSCAPE": "env-landscape",
+			},
+			want: Config{
+				APIBaseURL: "https://env.example.com", RequestTimeout: time.Minute, RunTimeout: 10 * time.Minute,
+				DefaultToken: "env-token", LandscapeID: "env-landscape", VersionID: "project-version", DiagramName: "Dev services",
+				Classifier: Classifier{ExternalPatterns: []string{"Partner"}, DatabasePatterns: []string{"Store"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			cfg, err := Load(tt.profile)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			// Retry and concurrency settings are covered elsewhere.
+			tt.want.Retry, tt.want.Concurrency = cfg.Retry, cfg.Concurrency
+			if !reflect.DeepEqual(*cfg, tt.want) {
+				t.Errorf("Load() = %+v\nwant %+v", *cfg, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	clearEnv(t)
+
+	t.Run("no config files", func(t *testing.T) {
+		writeConfigs(t, "", "")
+		cfg, err := Load("")
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if !reflect.DeepEqual(cfg, NewConfig()) {
+			t.Errorf("Load() = %+v, want defaults", cfg)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		project string
+		profile string
+		wantErr string
+	}{
+		{name: "unknown profile", project: projectConfig, profile: "prod", wantErr: `profile "prod" not found`},
+		{name: "invalid yaml", project: "profiles: [", wantErr: "failed to parse config file"},
+		{name: "invalid timeout", project: "profiles:\n  p:\n    timeout: soon\n", profile: "p",
+			wantErr: `invalid profile timeout "soon"`},
+		{name: "missing token file", project: "profiles:\n  p:\n    token_file: /nonexistent/token\n", profile: "p",
+			wantErr: "failed to read token_file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeConfigs(t, "", tt.project)
+			_, err := Load(tt.profile)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
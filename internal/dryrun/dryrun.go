@@ -0,0 +1,72 @@
+// Package dryrun describes what an import would change in IcePanel without
+// changing anything.
+package dryrun
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"mermaid-icepanel/internal/api"
+)
+
+// Report lists every delete a wipe would make and the diagram that would be
+// posted afterwards.
+type Report struct {
+	Landscape string           `json:"landscape"`
+	Version   string           `json:"version"`
+	Wipe      []api.WipeTarget `json:"wipe"` // nil when the import does not wipe
+	Diagram   *api.Diagram     `json:"diagram"`
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// Write writes the report in a human-readable form.
+func (r *Report) Write(w io.Writer) error {
+	ew := &errWriter{w: w}
+	ew.printf("Dry run: import into landscape %s, version %s\n", r.Landscape, r.Version)
+	if r.Wipe != nil {
+		total := 0
+		for _, t := range r.Wipe {
+			total += len(t.IDs)
+		}
+		ew.printf("Wipe: %d to delete\n", total)
+		for _, t := range r.Wipe {
+			for _, id := range t.IDs {
+				ew.printf("  - %s %s\n", t.Path, id)
+			}
+		}
+	}
+
+	d := r.Diagram
+	ew.printf("Post diagram %q: %d objects, %d connections\n", d.Name, len(d.Objects), len(d.Connections))
+	for _, o := range d.Objects {
+		ew.printf("  + object %s (%s) %q", o.Handle, o.Type, o.Name)
+		if o.Parent != "" {
+			ew.printf(" in %s", o.Parent)
+		}
+		ew.printf("\n")
+	}
+	for _, c := range d.Connections {
+		ew.printf("  + connection %s -> %s %q\n", c.From, c.To, c.Label)
+	}
+	return ew.err
+}
+
+// errWriter remembers the first write error so output code stays linear.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) printf(format string, args ...interface{}) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = fmt.Fprintf(e.w, format, args...)
+}
@@ -0,0 +1,101 @@
+package dryrun
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"mermaid-icepanel/internal/api"
+)
+
+func testReport(wipe []api.WipeTarget) *Report {
+	return &Report{
+		Landscape: "lc",
+		Version:   "v1",
+		Wipe:      wipe,
+		Diagram: &api.Diagram{
+			Name: "Shop",
+			Type: "app-diagram",
+			Objects: []*api.Object{
+				{Handle: "shop", Name: "Shop", Type: "group"},
+				{Handle: "web", Name: "Web", Type: "app", Parent: "shop"},
+			},
+			Connections: []*api.Connection{{Handle: "h0001", From: "web", To: "shop", Label: "Uses"}},
+		},
+	}
+}
+
+func TestReport_Write(t *testing.T) {
+	tests := []struct {
+		name string
+		wipe []api.WipeTarget
+		want string
+	}{
+		{
+			name: "without wipe",
+			want: `Dry run: import into landscape lc, version v1
+Post diagram "Shop": 2 objects, 1 connections
+  + object shop (group) "Shop"
+  + object web (app) "Web" in shop
+  + connection web -> shop "Uses"
+`,
+		},
+		{
+			name: "with wipe",
+			wipe: []api.WipeTarget{{Path: "diagrams", IDs: []string{"d1"}}, {Path: "model/objects", IDs: []string{"a", "b"}}},
+			want: `Dry run: import into landscape lc, version v1
+Wipe: 3 to delete
+  - diagrams d1
+  - model/objects a
+  - model/objects b
+Post diagram "Shop": 2 objects, 1 connections
+  + object shop (group) "Shop"
+  + object web (app) "Web" in shop
+  + connection web -> shop "Uses"
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := testReport(tt.wipe).Write(&b); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			if b.String() != tt.want {
+				t.Errorf("Write() =\n%s\nwant:\n%s", b.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestReport_WriteJSON(t *testing.T) {
+	var b strings.Builder
+	r := testReport([]api.WipeTarget{{Path: "diagrams", IDs: []string{"d1"}}})
+	if err := r.WriteJSON(&b); err != nil {
+		t.Fatalf("WriteJSON() error = %v", err)
+	}
+
+	var got struct {
+		Landscape string `json:"landscape"`
+		Wipe      []struct {
+			Path string   `json:"path"`
+			IDs  []string `json:"ids"`
+		} `json:"wipe"`
+		Diagram struct {
+			Objects []struct {
+				Handle string `json:"handleId"`
+				Parent string `json:"parentId"`
+			} `json:"objects"`
+		} `json:"diagram"`
+	}
+	if err := json.Unmarshal([]byte(b.String()), &got); err != nil {
+		t.Fatalf("WriteJSON() wrote invalid JSON: %v\n%s", err, b.String())
+	}
+	if got.Landscape != "lc" || len(got.Wipe) != 1 || got.Wipe[0].IDs[0] != "d1" {
+		t.Errorf("WriteJSON() = %s", b.String())
+	}
+	if len(got.Diagram.Objects) != 2 || got.Diagram.Objects[1].Parent != "shop" {
+		t.Errorf("WriteJSON() objects = %+v", got.Diagram.Objects)
+	}
+}
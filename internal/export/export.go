@@ -0,0 +1,351 @@
+// Package export renders the objects and connections of an IcePanel version
+// as a Mermaid C4 diagram that the parser can read back.
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"mermaid-icepanel/internal/api"
+	"mermaid-icepanel/internal/parser"
+)
+
+// Lister is the part of the IcePanel client needed to export a version.
+type Lister interface {
+	ListObjects(ctx context.Context, lc, ver string) ([]*api.Object, error)
+	ListConnections(ctx context.Context, lc, ver string) ([]*api.Connection, error)
+}
+
+// Fetch reads every object and connection of a landscape version.
+func Fetch(ctx context.Context, c Lister, lc, ver string) (*api.Diagram, error) {
+	objs, err := c.ListObjects(ctx, lc, ver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+	conns, err := c.ListConnections(ctx, lc, ver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list connections: %w", err)
+	}
+	return &api.Diagram{Objects: objs, Connections: conns}, nil
+}
+
+// reElementKeyword matches the container and component keywords the parser
+// records in the "c4" property.
+var reElementKeyword = regexp.MustCompile(`^(Container|Component)(Db|Queue)?(_Ext)?$`)
+
+// reAliasUnsafe matches characters that cannot appear in a Mermaid alias.
+var reAliasUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// Write renders the diagram as Mermaid C4. Groups, and apps read from a
+// Container_Boundary, become boundaries and objects are nested under the
+// closest such boundary among their ancestors;
+// connections that mirror each other with the same label become BiRel.
+// A non-empty diagram name is written as the title.
+//
+// Reading the output back with the parser gives the same objects and
+// connection labels. Where a statement cannot carry a value as it is, such
+// as a mixed-case handle or a name with quotes, it is preceded by a
+// parser.DirectivePrefix comment holding just the values it loses.
+func Write(w io.Writer, d *api.Diagram) error {
+	e := &exporter{
+		byHandle: make(map[string]*api.Object, len(d.Objects)),
+		children: make(map[string][]*api.Object),
+		aliases:  make(map[string]string, len(d.Objects)),
+	}
+	used := make(map[string]bool, len(d.Objects))
+	for _, o := range d.Objects {
+		e.byHandle[o.Handle] = o
+		alias := Alias(o.Handle)
+		for i := 2; used[alias]; i++ {
+			alias = fmt.Sprintf("%s_%d", Alias(o.Handle), i)
+		}
+		used[alias] = true
+		e.aliases[o.Handle] = alias
+	}
+	var roots []*api.Object
+	for _, o := range d.Objects {
+		if g := e.group(o); g != "" {
+			e.children[g] = append(e.children[g], o)
+		} else {
+			roots = append(roots, o)
+		}
+	}
+
+	fmt.Fprintln(&e.b, header(d.Objects))
+	if d.Name != "" {
+		fmt.Fprintf(&e.b, "title %s\n", d.Name)
+	}
+	for _, o := range roots {
+		if err := e.object(o, 0); err != nil {
+			return err
+		}
+	}
+	if err := e.relations(d.Connections); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, e.b.String())
+	return err
+}
+
+type exporter struct {
+	b        strings.Builder
+	byHandle map[string]*api.Object
+	children map[string][]*api.Object // keyed by the handle of the enclosing group
+	aliases  map[string]string        // Mermaid alias of each object, keyed by handle
+}
+
+// alias returns the Mermaid alias of the object with the given handle.
+func (e *exporter) alias(handle string) string {
+	if a, ok := e.aliases[handle]; ok {
+		return a
+	}
+	return Alias(handle)
+}
+
+// group returns the handle of the closest ancestor of o written as a boundary.
+func (e *exporter) group(o *api.Object) string {
+	seen := map[string]bool{o.Handle: true}
+	for h := o.Parent; h != "" && !seen[h]; {
+		p, ok := e.byHandle[h]
+		if !ok {
+			return ""
+		}
+		if isBoundary(p) {
+			return h
+		}
+		seen[h] = true
+		h = p.Parent
+	}
+	return ""
+}
+
+func (e *exporter) object(o *api.Object, depth int) error {
+	indent := strings.Repeat("  ", depth)
+	name, desc := quote(o.Name), quote(o.Desc)
+	if name == "" {
+		name = o.Handle
+	}
+	alias := e.alias(o.Handle)
+	// read is the object the parser builds from the statement alone.
+	read := &api.Object{Handle: strings.ToLower(alias), Name: name, Parent: e.group(o)}
+
+	if isBoundary(o) {
+		kw := boundaryKeyword(o)
+		read.Type = o.Type
+		if kw != "System_Boundary" {
+			read.Props = map[string]interface{}{"c4": kw}
+		}
+		if err := e.directive(indent, o, read); err != nil {
+			return err
+		}
+		fmt.Fprintf(&e.b, "%s%s(%s, \"%s\") {\n", indent, kw, alias, name)
+		for _, c := range e.children[o.Handle] {
+			if err := e.object(c, depth+1); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(&e.b, "%s}\n", indent)
+		return nil
+	}
+
+	if kw := elementKeyword(o); kw != "" {
+		techn, _ := o.Props["technology"].(string)
+		techn = quote(techn)
+		read.Type, read.Desc = elementType(kw), desc
+		read.Props = map[string]interface{}{"c4": kw}
+		if techn != "" {
+			read.Props["technology"] = techn
+		}
+		if strings.HasSuffix(kw, "_Ext") {
+			read.Props["external"] = true
+		}
+		if err := e.directive(indent, o, read); err != nil {
+			return err
+		}
+		fmt.Fprintf(&e.b, "%s%s(%s, \"%s\", \"%s\", \"%s\")\n", indent, kw, alias, name, techn, desc)
+		return nil
+	}
+
+	kw := keyword(o)
+	read.Type, read.Desc = systemTypes[strings.TrimSuffix(kw, "_Ext")], desc
+	if strings.HasSuffix(kw, "_Ext") {
+		read.Props = map[string]interface{}{"external": true}
+	}
+	if err := e.directive(indent, o, read); err != nil {
+		return err
+	}
+	fmt.Fprintf(&e.b, "%s%s(%s, \"%s\"", indent, kw, alias, name)
+	if desc != "" {
+		fmt.Fprintf(&e.b, ", \"%s\"", desc)
+	}
+	e.b.WriteString(")\n")
+	return nil
+}
+
+// directiveFields maps the field names of api.Object.Diff to their JSON names.
+var directiveFields = map[string]string{
+	"Name": "name", "Desc": "description", "Type": "type", "Parent": "parentId",
+}
+
+// directive writes the fields of o that the parser would read differently
+// from its statement before the statement, so only those override it.
+// A property the statement adds but o lacks is written as null.
+func (e *exporter) directive(indent string, o, read *api.Object) error {
+	fields := make(map[string]interface{})
+	if read.Handle != o.Handle {
+		fields["handleId"] = o.Handle
+	}
+	props := make(map[string]interface{})
+	for f, v := range read.Diff(o) {
+		if k, ok := strings.CutPrefix(f, "Props."); ok {
+			props[k] = v[1]
+		} else {
+			fields[directiveFields[f]] = v[1]
+		}
+	}
+	if len(props) > 0 {
+		fields["properties"] = props
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("failed to encode object %s: %w", o.Handle, err)
+	}
+	fmt.Fprintf(&e.b, "%s%s%s\n", indent, parser.DirectivePrefix, b)
+	return nil
+}
+
+// systemTypes maps the person and system keywords, without _Ext, to the object
+// types the parser gives them.
+var systemTypes = map[string]string{
+	"Person": "actor", "System": "system", "SystemDb": "store",
+}
+
+// elementType returns the object type the parser gives a container or
+// component keyword.
+func elementType(kw string) string {
+	switch {
+	case strings.HasPrefix(kw, "Component"):
+		return "component"
+	case strings.HasPrefix(kw, "ContainerDb"), strings.HasPrefix(kw, "ContainerQueue"):
+		return "store"
+	}
+	return "app"
+}
+
+// elementKeyword returns the container or component keyword for o, or "" if
+// o is written as a person or system.
+func elementKeyword(o *api.Object) string {
+	if kw, _ := o.Props["c4"].(string); reElementKeyword.MatchString(kw) {
+		return kw
+	}
+	var kw string
+	switch o.Type {
+	case "app":
+		kw = "Container"
+	case "component":
+		kw = "Component"
+	default:
+		return ""
+	}
+	if external, _ := o.Props["external"].(bool); external {
+		kw += "_Ext"
+	}
+	return kw
+}
+
+// keyword returns the C4 keyword for a person or system.
+func keyword(o *api.Object) string {
+	kw := "System"
+	switch o.Type {
+	case "actor":
+		kw = "Person"
+	case "store":
+		kw = "SystemDb"
+	}
+	if external, _ := o.Props["external"].(bool); external {
+		kw += "_Ext"
+	}
+	return kw
+}
+
+// isBoundary reports whether o is written as a boundary enclosing its
+// children: a group, or an app the parser read from a Container_Boundary.
+func isBoundary(o *api.Object) bool {
+	kw, _ := o.Props["c4"].(string)
+	return o.Type == "group" || o.Type == "app" && kw == "Container_Boundary"
+}
+
+func boundaryKeyword(o *api.Object) string {
+	switch kw, _ := o.Props["c4"].(string); kw {
+	case "Boundary", "Enterprise_Boundary", "Container_Boundary":
+		return kw
+	}
+	return "System_Boundary"
+}
+
+// header picks the most detailed C4 diagram kind needed for the objects.
+func header(objs []*api.Object) string {
+	kind := "C4Context"
+	for _, o := range objs {
+		kw, _ := o.Props["c4"].(string)
+		switch {
+		case o.Type == "component" || strings.HasPrefix(kw, "Component"):
+			return "C4Component"
+		case o.Type == "app" || strings.HasPrefix(kw, "Container"):
+			kind = "C4Container"
+		}
+	}
+	return kind
+}
+
+// relations writes one Rel per connection, folding a connection and a later
+// one in the opposite direction with the same label into a single BiRel.
+// A label the statement cannot carry as it is gets a directive and is never
+// folded.
+func (e *exporter) relations(conns []*api.Connection) error {
+	used := make([]bool, len(conns))
+	for i, c := range conns {
+		if used[i] {
+			continue
+		}
+		label := quote(c.Label)
+		kw := "Rel"
+		if label != c.Label {
+			b, err := json.Marshal(map[string]string{"name": c.Label})
+			if err != nil {
+				return fmt.Errorf("failed to encode connection %s: %w", c.Handle, err)
+			}
+			fmt.Fprintf(&e.b, "%s%s\n", parser.DirectivePrefix, b)
+		} else {
+			for j := i + 1; j < len(conns); j++ {
+				r := conns[j]
+				if !used[j] && r.From == c.To && r.To == c.From && r.Label == c.Label && c.From != c.To {
+					used[j] = true
+					kw = "BiRel"
+					break
+				}
+			}
+		}
+		fmt.Fprintf(&e.b, "%s(%s, %s, \"%s\")\n", kw, e.alias(c.From), e.alias(c.To), label)
+	}
+	return nil
+}
+
+// Alias returns the Mermaid alias used for an object handle.
+func Alias(handle string) string {
+	return reAliasUnsafe.ReplaceAllString(handle, "_")
+}
+
+// quote makes s safe inside a double-quoted Mermaid argument.
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `"`, "'")
+	return strings.Join(strings.Fields(s), " ")
+}
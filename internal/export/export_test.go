@@ -0,0 +1,206 @@
+package export
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mermaid-icepanel/internal/api"
+	"mermaid-icepanel/internal/parser"
+)
+
+// stringReader implements parser.FileReader over an in-memory string.
+type stringReader string
+
+func (s stringReader) ReadFile(_ string) (parser.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(string(s))), nil
+}
+
+func parse(t *testing.T, src string) *api.Diagram {
+	t.Helper()
+	d, err := parser.ParseMermaid(stringReader(src), "test.mmd")
+	if err != nil {
+		t.Fatalf("ParseMermaid() error = %v", err)
+	}
+	return d
+}
+
+func TestWrite_RoundTrip(t *testing.T) {
+	src := `C4Container
+title Internet Banking
+Person(customer, "Customer", "A bank customer")
+Enterprise_Boundary(bank, "Big Bank") {
+  System(banking, "Internet Banking", "Lets customers bank online")
+  SystemDb(ledger, "Ledger")
+  System_Boundary(ib, "Internet Banking") {
+    Container(web, "Web App", "Go", "Serves the UI")
+    ContainerDb_Ext(db, "Database", "Postgres", "")
+    Container_Boundary(api, "API") {
+      Component(auth, "Auth", "", "Signs people in")
+    }
+  }
+  Boundary(empty, "Empty") {
+  }
+}
+System_Ext(mail, "Mail System")
+Rel(customer, web, "Uses", "HTTPS")
+BiRel(web, db, "Reads and writes")
+Rel(auth, mail, "")
+Rel(web, mail, "Sends")
+`
+	first := parse(t, src)
+	first.Name = "Internet Banking"
+
+	var out strings.Builder
+	if err := Write(&out, first); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	second := parse(t, out.String())
+	second.Name = first.Name
+
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("round trip changed the diagram\nexported:\n%s", out.String())
+		for i := range max(len(first.Objects), len(second.Objects)) {
+			if i >= len(first.Objects) || i >= len(second.Objects) || !reflect.DeepEqual(first.Objects[i], second.Objects[i]) {
+				t.Errorf("object %d differs", i)
+			}
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	d := &api.Diagram{
+		Objects: []*api.Object{
+			{Handle: "team", Name: "Team", Type: "group"},
+			{Handle: "shop", Name: "Shop", Type: "system", Parent: "team"},
+			{Handle: "api", Name: `The "API"`, Desc: "Line one\nline two", Type: "app", Parent: "shop"},
+			{Handle: "pay.v1", Name: "Payments", Type: "system", Props: map[string]interface{}{"external": true}},
+			{Handle: "orphan", Name: "", Type: "component", Parent: "unknown"},
+		},
+		Connections: []*api.Connection{
+			{Handle: "c1", From: "api", To: "pay.v1", Label: "charges"},
+			{Handle: "c2", From: "shop", To: "api", Label: ""},
+			{Handle: "c3", From: "pay.v1", To: "api", Label: "charges"},
+		},
+	}
+	want := `C4Component
+System_Boundary(team, "Team") {
+  System(shop, "Shop")
+  %% icepanel: {"description":"Line one\nline two","name":"The \"API\"","parentId":"shop","properties":{"c4":null}}
+  Container(api, "The 'API'", "", "Line one line two")
+}
+%% icepanel: {"handleId":"pay.v1"}
+System_Ext(pay_v1, "Payments")
+%% icepanel: {"name":"","parentId":"unknown","properties":{"c4":null}}
+Component(orphan, "orphan", "", "")
+BiRel(api, pay_v1, "charges")
+Rel(shop, api, "")
+`
+	var out strings.Builder
+	if err := Write(&out, d); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if out.String() != want {
+		t.Errorf("Write() =\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+// TestWrite_RoundTripFromIcePanel starts from objects that were not made by
+// the parser, so their handles, names and properties are not in the forms a
+// Mermaid statement can carry.
+func TestWrite_RoundTripFromIcePanel(t *testing.T) {
+	d := &api.Diagram{
+		Objects: []*api.Object{
+			{Handle: "Shop.v1", Name: "Shop", Type: "group"},
+			{Handle: "service-Orders", Name: `Orders "v2"`, Desc: "Takes orders.\n\nSee  the wiki.", Type: "app",
+				Parent: "Shop.v1", Props: map[string]interface{}{"package": "shop.v1", "technology": "gRPC"}},
+			{Handle: "method-Orders-Get", Name: "Get", Type: "component", Parent: "service-Orders",
+				Props: map[string]interface{}{"c4": "Component", "request": "shop.v1.GetRequest"}},
+			{Handle: "pay.v1", Name: "", Type: "system", Props: map[string]interface{}{"external": true}},
+			{Handle: "pay_v1", Name: "Payments ledger", Type: "store"},
+			{Handle: "web", Name: "Web", Desc: "Plain", Type: "app",
+				Props: map[string]interface{}{"c4": "Container", "technology": "Go"}},
+			{Handle: "partner", Name: "Partner", Type: "actor", Props: map[string]interface{}{"external": true}},
+			{Handle: "ledger", Name: "Ledger", Type: "store", Props: map[string]interface{}{"external": true}},
+		},
+		Connections: []*api.Connection{
+			{Handle: "c1", From: "service-Orders", To: "pay.v1", Label: `charges "cards"`},
+			{Handle: "c2", From: "pay.v1", To: "service-Orders", Label: `charges "cards"`},
+			{Handle: "c3", From: "web", To: "service-Orders", Label: "places\norders"},
+			{Handle: "c4", From: "service-Orders", To: "pay_v1", Label: "records"},
+		},
+	}
+
+	var out strings.Builder
+	if err := Write(&out, d); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	got := parse(t, out.String())
+	for _, stmt := range []string{`Person_Ext(partner, "Partner")`, `SystemDb_Ext(ledger, "Ledger")`} {
+		if !strings.Contains(out.String(), stmt) {
+			t.Errorf("exported diagram lacks %s\n%s", stmt, out.String())
+		}
+	}
+
+	if !reflect.DeepEqual(got.Objects, d.Objects) {
+		t.Errorf("objects changed in the round trip\nexported:\n%s", out.String())
+		for i := range min(len(got.Objects), len(d.Objects)) {
+			if !reflect.DeepEqual(got.Objects[i], d.Objects[i]) {
+				t.Errorf("got %+v\nwant %+v", got.Objects[i], d.Objects[i])
+			}
+		}
+	}
+	if len(got.Connections) != len(d.Connections) {
+		t.Fatalf("connections = %d, want %d\nexported:\n%s", len(got.Connections), len(d.Connections), out.String())
+	}
+	for i, c := range got.Connections {
+		if want := d.Connections[i]; c.From != want.From || c.To != want.To || c.Label != want.Label {
+			t.Errorf("connection %d = %+v, want %+v", i, c, want)
+		}
+	}
+	lines := strings.Split(out.String(), "\n")
+	for i, l := range lines {
+		if strings.HasPrefix(strings.TrimSpace(l), "Container(web,") && strings.Contains(lines[i-1], "%% icepanel:") {
+			t.Errorf("web needs no directive:\n%s", out.String())
+		}
+	}
+}
+
+// TestWrite_EditedStatement checks that a directive only overrides what the
+// statement cannot carry, so edits made to the exported file are imported.
+func TestWrite_EditedStatement(t *testing.T) {
+	d := &api.Diagram{
+		Objects: []*api.Object{
+			{Handle: "Shop", Name: "Shop", Type: "system"},
+			{Handle: "service-Orders", Name: "Orders", Desc: "Takes orders", Type: "app", Parent: "Shop",
+				Props: map[string]interface{}{"c4": "Container", "package": "shop.v1", "technology": "gRPC"}},
+		},
+		Connections: []*api.Connection{
+			{Handle: "c1", From: "Shop", To: "service-Orders", Label: "routes"},
+		},
+	}
+	var out strings.Builder
+	if err := Write(&out, d); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	edited := strings.NewReplacer(
+		`Container(service-Orders, "Orders", "gRPC", "Takes orders")`,
+		`Container(service-Orders, "Order service", "Go", "Takes and tracks orders")`,
+		`"routes"`, `"forwards"`,
+	).Replace(out.String())
+	if edited == out.String() {
+		t.Fatalf("statements to edit not found in\n%s", out.String())
+	}
+
+	got := parse(t, edited)
+	want := &api.Object{Handle: "service-Orders", Name: "Order service", Desc: "Takes and tracks orders",
+		Type: "app", Parent: "Shop",
+		Props: map[string]interface{}{"c4": "Container", "package": "shop.v1", "technology": "Go"}}
+	if len(got.Objects) != 2 || !reflect.DeepEqual(got.Objects[1], want) {
+		t.Errorf("objects = %+v\nwant edits kept in %+v\nexported:\n%s", got.Objects, want, edited)
+	}
+	if len(got.Connections) != 1 || got.Connections[0].Label != "forwards" {
+		t.Errorf("connections = %+v, want the edited label", got.Connections)
+	}
+}
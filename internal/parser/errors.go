@@ -0,0 +1,119 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"mermaid-icepanel/internal/api"
+)
+
+// Options controls how strictly a Mermaid file is parsed.
+type Options struct {
+	// Strict makes Parse fail on any line it cannot understand.
+	Strict bool
+}
+
+// Result is the outcome of a lenient parse.
+type Result struct {
+	Diagram  *api.Diagram
+	Warnings []*ParseError // lines that were skipped
+}
+
+// ParseError describes a line of a Mermaid file that could not be parsed.
+type ParseError struct {
+	File     string
+	Line     int
+	Column   int
+	Text     string // the offending line, trimmed
+	Expected string // the form the parser expected instead
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: cannot parse %q, expected %s", e.File, e.Line, e.Column, e.Text, e.Expected)
+}
+
+// ParseErrors is returned by Parse in strict mode and lists every problem found.
+type ParseErrors []*ParseError
+
+func (e ParseErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, pe := range e {
+		msgs[i] = pe.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+var reKeyword = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*`)
+
+// expectedForms maps the statements the parser supports to their accepted form.
+var expectedForms = map[string]string{
+	"Person":              `Person(alias, "label", "description")`,
+	"Person_Ext":          `Person_Ext(alias, "label", "description")`,
+	"System":              `System(alias, "label", "description")`,
+	"System_Ext":          `System_Ext(alias, "label", "description")`,
+	"SystemDb":            `SystemDb(alias, "label", "description")`,
+	"SystemDb_Ext":        `SystemDb_Ext(alias, "label", "description")`,
+	"SystemQueue":         `SystemQueue(alias, "label", "description")`,
+	"SystemQueue_Ext":     `SystemQueue_Ext(alias, "label", "description")`,
+	"Boundary":            `Boundary(alias, "label") {`,
+	"Enterprise_Boundary": `Enterprise_Boundary(alias, "label") {`,
+	"System_Boundary":     `System_Boundary(alias, "label") {`,
+	"Container_Boundary":  `Container_Boundary(alias, "label") {`,
+	"Container":           `Container(alias, "label", "technology", "description")`,
+	"Component":           `Component(alias, "label", "technology", "description")`,
+	"Rel":                 `Rel(from, to, "label")`,
+	"BiRel":               `BiRel(from, to, "label")`,
+}
+
+// ignoredStatements are valid Mermaid C4 lines that carry no model information.
+var ignoredStatements = map[string]bool{
+	"C4Context": true, "C4Container": true, "C4Component": true, "C4Dynamic": true, "C4Deployment": true,
+	"title": true, "UpdateElementStyle": true, "UpdateRelStyle": true, "UpdateBoundaryStyle": true,
+	"UpdateLayoutConfig": true, "AddElementTag": true, "AddRelTag": true, "AddBoundaryTag": true,
+	"Deployment_Node": true, "Node": true, "Node_L": true, "Node_R": true,
+}
+
+// diagnose explains why a line was not understood.
+func diagnose(raw, line string) *ParseError {
+	indent := strings.Index(raw, line)
+	perr := &ParseError{Column: indent + 1, Text: line}
+
+	if line == "}" {
+		perr.Expected = "an open boundary before }"
+		return perr
+	}
+	kw := reKeyword.FindString(line)
+	if form, ok := expectedForms[statementFamily(kw)]; ok {
+		// The statement is known, so the arguments are what is wrong.
+		if paren := strings.Index(line, "("); paren >= 0 {
+			perr.Column = indent + paren + 2
+		}
+		perr.Expected = form
+		return perr
+	}
+	perr.Expected = "a Person, System, Container, Component, boundary or Rel statement"
+	return perr
+}
+
+// statementFamily maps variants such as ContainerDb_Ext or Rel_U to
+// the base statement listed in expectedForms.
+func statementFamily(kw string) string {
+	if _, ok := expectedForms[kw]; ok {
+		return kw
+	}
+	for _, base := range []string{"Container", "Component"} {
+		rest := strings.TrimPrefix(kw, base)
+		if rest == kw {
+			continue
+		}
+		switch strings.TrimSuffix(rest, "_Ext") {
+		case "", "Db", "Queue":
+			return base
+		}
+	}
+	if strings.HasPrefix(kw, "Rel_") {
+		return "Rel"
+	}
+	return ""
+}
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"log"
 	"regexp"
@@ -26,18 +27,57 @@ func (r *DefaultFileReader) ReadFile(path string) (ReadCloser, error) {
 
 // ---------- regex definitions ----------.
 var (
-	rePerson   = regexp.MustCompile(`^Person\(([^,]+),\s*"([^"]+)"(?:,\s*"([^"]+)")?\)`)
-	reSystem   = regexp.MustCompile(`^System(_Ext|Db)?\(([^,]+),\s*"([^"]+)"(?:,\s*"([^"]+)")?\)`)
-	reBound    = regexp.MustCompile(`^System_Boundary\(([^,]+),\s*"([^"]+)"\)`)
-	reRel      = regexp.MustCompile(`^(Bi)?Rel\(([^,]+),\s*([^,]+),\s*"([^"]+)"\)`)
+	rePerson   = regexp.MustCompile(`^Person(_Ext)?\(([^,]+),\s*"([^"]+)"(?:,\s*"([^"]+)")?\)`)
+	reSystem   = regexp.MustCompile(`^System(Db|Queue)?(_Ext)?\(([^,]+),\s*"([^"]+)"(?:,\s*"([^"]+)")?\)`)
+	reBound    = regexp.MustCompile(`^(?:(Enterprise|System|Container)_)?Boundary\(([^,]+),\s*"([^"]+)"`)
+	reRel      = regexp.MustCompile(`^(Bi)?Rel(?:_[A-Za-z]+)?\(([^,]+),\s*([^,]+),\s*"([^"]*)"[^)]*\)`)
 	reEndBound = regexp.MustCompile(`^}`)
+	// Container(alias, "label", "techn", "descr") and the Db/Queue/_Ext variants,
+	// likewise for Component. Trailing sprite/tags/link arguments are ignored.
+	reElement = regexp.MustCompile(
+		`^(Container|Component)(Db|Queue)?(_Ext)?\(([^,]+),\s*"([^"]+)"(?:,\s*"([^"]*)")?(?:,\s*"([^"]*)")?[^)]*\)`)
 )
 
+// elementTypes maps C4 container/component levels to IcePanel object types.
+// IcePanel has no queue type, so queues become stores at the container level.
+var elementTypes = map[string]map[string]string{
+	"Container": {"": "app", "Db": "store", "Queue": "store"},
+	"Component": {"": "component", "Db": "component", "Queue": "component"},
+}
+
 // ---------- parser ----------.
 type mermaidParser struct {
-	objs  map[string]*api.Object
-	conns []*api.Connection
-	idSeq int
+	objs   map[string]*api.Object
+	order  []string // object ids in declaration order, so parents precede children
+	conns  []*api.Connection
+	idSeq  int
+	bounds []openBound // enclosing boundaries, innermost last
+	annot  *annotation // from the directive on the previous line, if any
+}
+
+// DirectivePrefix starts a comment line that holds, as JSON, the IcePanel
+// fields the statement on the next line cannot carry as they are, for example
+// a name containing quotes. The statement supplies every other field, so
+// edits to those are kept. The exporter writes one when it is needed.
+const DirectivePrefix = "%% icepanel: "
+
+// annotation is a decoded directive. Its fields use the JSON names of
+// api.Object; nil ones are left as the statement has them. Before a relation,
+// Name is the connection label.
+type annotation struct {
+	Handle *string                `json:"handleId"`
+	Name   *string                `json:"name"`
+	Desc   *string                `json:"description"`
+	Type   *string                `json:"type"`
+	Parent *string                `json:"parentId"`
+	Props  map[string]interface{} `json:"properties"` // a null value removes the property
+}
+
+// openBound is a boundary whose closing brace has not been seen yet.
+type openBound struct {
+	handle string // empty for the block of an ignored statement
+	line   int
+	text   string
 }
 
 func newMermaidParser() *mermaidParser {
@@ -62,20 +102,109 @@ func (p *mermaidParser) addObj(id, name, desc, typ string) {
 		Name:   name,
 		Desc:   desc,
 		Type:   typ,
+		Parent: p.parent(),
+	}
+	p.order = append(p.order, id)
+}
+
+// addElement adds a container or component, parented to the enclosing boundary.
+func (p *mermaidParser) addElement(m []string) {
+	level, variant, ext := m[1], m[2], m[3]
+	id, name, techn, desc := m[4], m[5], m[6], m[7]
+	p.addObj(id, name, desc, elementTypes[level][variant])
+	obj := p.objs[id]
+	obj.Props = map[string]interface{}{"c4": level + variant + ext}
+	if techn != "" {
+		obj.Props["technology"] = techn
+	}
+	if ext != "" {
+		obj.Props["external"] = true
+	}
+}
+
+// parent returns the handle of the innermost open boundary, if any,
+// skipping the blocks of ignored statements.
+func (p *mermaidParser) parent() string {
+	for i := len(p.bounds) - 1; i >= 0; i-- {
+		if h := p.bounds[i].handle; h != "" {
+			return h
+		}
 	}
+	return ""
 }
 
 func (p *mermaidParser) addConn(from, to, label string, bidi bool) {
+	if p.annot != nil && p.annot.Name != nil {
+		label = *p.annot.Name
+	}
+	from, to = p.handle(from), p.handle(to)
 	h := p.nextHandle()
-	p.conns = append(p.conns, &api.Connection{Handle: h, From: slug(from), To: slug(to), Label: label})
+	p.conns = append(p.conns, &api.Connection{Handle: h, From: from, To: to, Label: label})
 	if bidi {
 		h2 := p.nextHandle()
-		p.conns = append(p.conns, &api.Connection{Handle: h2, From: slug(to), To: slug(from), Label: label})
+		p.conns = append(p.conns, &api.Connection{Handle: h2, From: to, To: from, Label: label})
 	}
 }
 
+// handle returns the handle of the object declared with the given alias.
+func (p *mermaidParser) handle(id string) string {
+	if o, ok := p.objs[id]; ok {
+		return o.Handle
+	}
+	return slug(id)
+}
+
+// annotate sets the fields of the directive on the previous line on the
+// object declared by the current line, if it is new.
+func (p *mermaidParser) annotate(declared int) {
+	if p.annot == nil || len(p.order) == declared {
+		return
+	}
+	o, a := p.objs[p.order[declared]], p.annot
+	for _, f := range []struct{ dst, src *string }{
+		{&o.Handle, a.Handle}, {&o.Name, a.Name}, {&o.Desc, a.Desc}, {&o.Type, a.Type}, {&o.Parent, a.Parent},
+	} {
+		if f.src != nil {
+			*f.dst = *f.src
+		}
+	}
+	for k, v := range a.Props {
+		switch {
+		case v == nil:
+			delete(o.Props, k)
+		case o.Props == nil:
+			o.Props = map[string]interface{}{k: v}
+		default:
+			o.Props[k] = v
+		}
+	}
+	if len(o.Props) == 0 {
+		o.Props = nil
+	}
+}
+
+// parseDirective decodes the JSON of a directive line.
+func parseDirective(raw string) (*annotation, error) {
+	a := &annotation{}
+	if err := json.Unmarshal([]byte(raw), a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
 // ParseMermaid parses a Mermaid file and returns an IcePanel diagram.
+// Lines it does not understand are skipped; use Parse to see why.
 func ParseMermaid(fileReader FileReader, path string) (*api.Diagram, error) {
+	res, err := Parse(fileReader, path, Options{})
+	if err != nil {
+		return nil, err
+	}
+	return res.Diagram, nil
+}
+
+// Parse parses a Mermaid file. In strict mode any line that cannot be parsed
+// makes it return ParseErrors; otherwise those lines are reported as warnings.
+func Parse(fileReader FileReader, path string, opts Options) (*Result, error) {
 	f, err := fileReader.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("could not read file %s: %w", path, err)
@@ -88,46 +217,47 @@ func ParseMermaid(fileReader FileReader, path string) (*api.Diagram, error) {
 	}()
 
 	p := newMermaidParser()
+	var problems ParseErrors
+	lineNo := 0
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "//") {
-			continue
-		}
-		if m := rePerson.FindStringSubmatch(line); m != nil {
-			p.addObj(m[1], m[2], m[3], "actor")
-			continue
-		}
-		if m := reSystem.FindStringSubmatch(line); m != nil {
-			switch m[1] { // suffix group
-			case "_Ext":
-				p.addObj(m[2], m[3], m[4], "system")
-				p.objs[m[2]].Props = map[string]interface{}{"external": true}
-			case "Db":
-				p.addObj(m[2], m[3], m[4], "store")
-			default:
-				p.addObj(m[2], m[3], m[4], "system")
+		lineNo++
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
+		if rest, ok := strings.CutPrefix(line, DirectivePrefix); ok {
+			annot, err := parseDirective(rest)
+			if err != nil {
+				problems = append(problems, &ParseError{
+					File: path, Line: lineNo, Column: strings.Index(raw, line) + len(DirectivePrefix) + 1,
+					Text: line, Expected: "a JSON object after " + strings.TrimSpace(DirectivePrefix),
+				})
 			}
+			p.annot = annot
 			continue
 		}
-		if m := reBound.FindStringSubmatch(line); m != nil {
-			p.addObj(m[1], m[2], "", "group")
-			continue
-		}
-		if m := reRel.FindStringSubmatch(line); m != nil {
-			bidi := m[1] == "Bi"
-			p.addConn(m[2], m[3], m[4], bidi)
+		if line == "" || strings.HasPrefix(line, "//") || strings.HasPrefix(line, "%%") {
 			continue
 		}
-		if reEndBound.MatchString(line) {
-			// ignore
+		ok := p.parseLine(line, lineNo)
+		p.annot = nil
+		if ok {
 			continue
 		}
-		// ignore unknown lines (layout etc.)
+		perr := diagnose(raw, line)
+		perr.File, perr.Line = path, lineNo
+		problems = append(problems, perr)
 	}
 	if err := scanner.Err(); err != nil {
 		return nil, err
 	}
+	for _, b := range p.bounds {
+		problems = append(problems, &ParseError{
+			File: path, Line: b.line, Column: 1, Text: b.text, Expected: "a closing }",
+		})
+	}
+	if opts.Strict && len(problems) > 0 {
+		return nil, problems
+	}
 
 	// Build diagram
 	d := &api.Diagram{
@@ -136,8 +266,79 @@ func ParseMermaid(fileReader FileReader, path string) (*api.Diagram, error) {
 		Objects:     make([]*api.Object, 0, len(p.objs)),
 		Connections: p.conns,
 	}
-	for _, o := range p.objs {
-		d.Objects = append(d.Objects, o)
+	for _, id := range p.order {
+		d.Objects = append(d.Objects, p.objs[id])
+	}
+	return &Result{Diagram: d, Warnings: problems}, nil
+}
+
+// parseLine applies a single trimmed line to the parser state and reports
+// whether it was understood.
+func (p *mermaidParser) parseLine(line string, lineNo int) bool {
+	declared := len(p.order)
+	if m := rePerson.FindStringSubmatch(line); m != nil {
+		p.addObj(m[2], m[3], m[4], "actor")
+		if m[1] == "_Ext" {
+			p.objs[m[2]].Props = map[string]interface{}{"external": true}
+		}
+		p.annotate(declared)
+		return true
+	}
+	if m := reSystem.FindStringSubmatch(line); m != nil {
+		// IcePanel has no queue type, so queues become stores like databases.
+		typ := "system"
+		if m[1] != "" {
+			typ = "store"
+		}
+		p.addObj(m[3], m[4], m[5], typ)
+		if m[2] == "_Ext" {
+			p.objs[m[3]].Props = map[string]interface{}{"external": true}
+		}
+		p.annotate(declared)
+		return true
+	}
+	if m := reElement.FindStringSubmatch(line); m != nil {
+		p.addElement(m)
+		p.annotate(declared)
+		return true
+	}
+	if m := reBound.FindStringSubmatch(line); m != nil {
+		// A Container_Boundary draws the components of one container, so it
+		// becomes that app and its components get an app as their parent.
+		typ := "group"
+		if m[1] == "Container" {
+			typ = "app"
+		}
+		p.addObj(m[2], m[3], "", typ)
+		// System_Boundary is the default; record the others so they can be told apart.
+		switch m[1] {
+		case "":
+			p.objs[m[2]].Props = map[string]interface{}{"c4": "Boundary"}
+		case "Enterprise", "Container":
+			p.objs[m[2]].Props = map[string]interface{}{"c4": m[1] + "_Boundary"}
+		}
+		p.annotate(declared)
+		if strings.HasSuffix(line, "{") {
+			p.bounds = append(p.bounds, openBound{handle: p.handle(m[2]), line: lineNo, text: line})
+		}
+		return true
+	}
+	if m := reRel.FindStringSubmatch(line); m != nil {
+		bidi := m[1] == "Bi"
+		p.addConn(m[2], m[3], m[4], bidi)
+		return true
+	}
+	if ignoredStatements[reKeyword.FindString(line)] {
+		// Nothing is imported from these, but the block of a deployment
+		// node still has to be matched with its closing brace.
+		if strings.HasSuffix(line, "{") {
+			p.bounds = append(p.bounds, openBound{line: lineNo, text: line})
+		}
+		return true
+	}
+	if reEndBound.MatchString(line) && len(p.bounds) > 0 {
+		p.bounds = p.bounds[:len(p.bounds)-1]
+		return true
 	}
-	return d, nil
+	return false
 }
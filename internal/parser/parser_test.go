@@ -1,9 +1,13 @@
 package parser
 
 import (
+	"errors"
 	"io"
+	"reflect"
 	"strings"
 	"testing"
+
+	"mermaid-icepanel/internal/api"
 )
 
 // MockFileReader implements FileReader for testing.
@@ -64,6 +68,23 @@ BiRel(app, api, "Syncs")
 			wantRels: 2, // BiRel creates 2 relationships
 			wantErr:  false,
 		},
+		{
+			name: "Container diagram",
+			content: `
+Person(user, "User")
+System_Boundary(shop, "Shop") {
+  Container(web, "Web App", "Go", "Serves the UI")
+  ContainerDb(db, "Database", "PostgreSQL", "Stores orders")
+  ContainerQueue(events, "Events", "Kafka")
+  Container_Ext(cdn, "CDN")
+}
+Rel(user, web, "Uses")
+Rel(web, db, "Reads")
+`,
+			wantObjs: 6, // 5 elements + boundary
+			wantRels: 2,
+			wantErr:  false,
+		},
 		{
 			name:     "Empty content",
 			content:  "",
@@ -98,6 +119,327 @@ BiRel(app, api, "Syncs")
 	}
 }
 
+func TestParseMermaid_ContainersAndComponents(t *testing.T) {
+	content := `
+Container(api, "API", "Go", "Public API")
+Container_Boundary(api_b, "API") {
+  Component(handler, "Handler", "net/http", "Routes requests")
+  ComponentDb_Ext(cache, "Cache", "Redis")
+}
+ContainerQueue_Ext(bus, "Bus")
+`
+	got, err := ParseMermaid(&MockFileReader{MockData: content}, "dummy.mmd")
+	if err != nil {
+		t.Fatalf("ParseMermaid() error = %v", err)
+	}
+	objs := make(map[string]*api.Object)
+	for _, o := range got.Objects {
+		objs[o.Handle] = o
+	}
+
+	tests := []struct {
+		handle, typ, parent, c4, techn string
+		external                       bool
+	}{
+		{handle: "api", typ: "app", c4: "Container", techn: "Go"},
+		{handle: "handler", typ: "component", parent: "api_b", c4: "Component", techn: "net/http"},
+		{handle: "cache", typ: "component", parent: "api_b", c4: "ComponentDb_Ext", techn: "Redis", external: true},
+		{handle: "bus", typ: "store", c4: "ContainerQueue_Ext", external: true},
+		{handle: "api_b", typ: "app", c4: "Container_Boundary"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.handle, func(t *testing.T) {
+			o, ok := objs[tt.handle]
+			if !ok {
+				t.Fatalf("object %s not found", tt.handle)
+			}
+			if o.Type != tt.typ {
+				t.Errorf("Type = %s, want %s", o.Type, tt.typ)
+			}
+			if o.Parent != tt.parent {
+				t.Errorf("Parent = %q, want %q", o.Parent, tt.parent)
+			}
+			if o.Props["c4"] != tt.c4 {
+				t.Errorf("Props[c4] = %v, want %s", o.Props["c4"], tt.c4)
+			}
+			if tt.techn != "" && o.Props["technology"] != tt.techn {
+				t.Errorf("Props[technology] = %v, want %s", o.Props["technology"], tt.techn)
+			}
+			if _, ext := o.Props["external"]; ext != tt.external {
+				t.Errorf("Props[external] present = %v, want %v", ext, tt.external)
+			}
+		})
+	}
+	if objs["api"].Desc != "Public API" {
+		t.Errorf("api description = %q, want %q", objs["api"].Desc, "Public API")
+	}
+}
+
+func TestParseMermaid_ComponentParentIsApp(t *testing.T) {
+	content := `
+System_Boundary(shop, "Shop") {
+  Container_Boundary(api, "API") {
+    Component(orders, "Orders", "Go")
+    ComponentDb(carts, "Carts")
+  }
+}
+`
+	got, err := ParseMermaid(&MockFileReader{MockData: content}, "dummy.mmd")
+	if err != nil {
+		t.Fatalf("ParseMermaid() error = %v", err)
+	}
+	objs := make(map[string]*api.Object)
+	for _, o := range got.Objects {
+		objs[o.Handle] = o
+	}
+	for _, h := range []string{"orders", "carts"} {
+		parent, ok := objs[objs[h].Parent]
+		if !ok {
+			t.Fatalf("%s parent %q not found", h, objs[h].Parent)
+		}
+		if parent.Type != "app" {
+			t.Errorf("%s parent %s has type %s, want app", h, parent.Handle, parent.Type)
+		}
+	}
+	if objs["api"].Parent != "shop" {
+		t.Errorf("api parent = %q, want shop", objs["api"].Parent)
+	}
+}
+
+func TestParseMermaid_NestedBoundaries(t *testing.T) {
+	content := `
+Person(customer, "Customer")
+Enterprise_Boundary(corp, "Corp") {
+  Person(staff, "Staff")
+  System_Boundary(shop, "Shop") {
+    Container_Boundary(api, "API") {
+      Component(orders, "Orders", "Go")
+    }
+    ContainerDb(db, "DB", "PostgreSQL")
+  }
+  Boundary(misc, "Misc") {
+    System(mail, "Mail")
+  }
+}
+System(bank, "Bank")
+`
+	got, err := ParseMermaid(&MockFileReader{MockData: content}, "dummy.mmd")
+	if err != nil {
+		t.Fatalf("ParseMermaid() error = %v", err)
+	}
+
+	wantParents := map[string]string{
+		"customer": "",
+		"corp":     "",
+		"staff":    "corp",
+		"shop":     "corp",
+		"api":      "shop",
+		"orders":   "api",
+		"db":       "shop",
+		"misc":     "corp",
+		"mail":     "misc",
+		"bank":     "",
+	}
+	wantC4 := map[string]interface{}{"corp": "Enterprise_Boundary", "api": "Container_Boundary", "misc": "Boundary"}
+	if len(got.Objects) != len(wantParents) {
+		t.Fatalf("got %d objects, want %d", len(got.Objects), len(wantParents))
+	}
+	seen := make(map[string]bool)
+	for _, o := range got.Objects {
+		if o.Parent != wantParents[o.Handle] {
+			t.Errorf("%s parent = %q, want %q", o.Handle, o.Parent, wantParents[o.Handle])
+		}
+		if o.Parent != "" && !seen[o.Parent] {
+			t.Errorf("%s listed before its parent %s", o.Handle, o.Parent)
+		}
+		if c4, ok := wantC4[o.Handle]; ok && o.Props["c4"] != c4 {
+			t.Errorf("%s c4 = %v, want %v", o.Handle, o.Props["c4"], c4)
+		}
+		seen[o.Handle] = true
+	}
+}
+
+func TestParse_ExtendedStatements(t *testing.T) {
+	content := `C4Deployment
+Person_Ext(partner, "Partner", "Places orders by EDI")
+SystemQueue(events, "Events")
+SystemDb_Ext(ledger, "Ledger")
+SystemQueue_Ext(feed, "Feed")
+`
+	res, err := Parse(&MockFileReader{MockData: content}, "deploy.mmd", Options{Strict: true})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	objs := make(map[string]*api.Object)
+	for _, o := range res.Diagram.Objects {
+		objs[o.Handle] = o
+	}
+
+	tests := []struct {
+		handle, typ string
+		external    bool
+	}{
+		{handle: "partner", typ: "actor", external: true},
+		{handle: "events", typ: "store"},
+		{handle: "ledger", typ: "store", external: true},
+		{handle: "feed", typ: "store", external: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.handle, func(t *testing.T) {
+			o, ok := objs[tt.handle]
+			if !ok {
+				t.Fatalf("object %s not found", tt.handle)
+			}
+			if o.Type != tt.typ {
+				t.Errorf("Type = %s, want %s", o.Type, tt.typ)
+			}
+			if _, ext := o.Props["external"]; ext != tt.external {
+				t.Errorf("Props[external] present = %v, want %v", ext, tt.external)
+			}
+		})
+	}
+
+	// Malformed lines are reported against the statement they misuse.
+	_, err = Parse(&MockFileReader{MockData: "SystemQueue_Ext(feed)\n"}, "bad.mmd", Options{Strict: true})
+	var perrs ParseErrors
+	if !errors.As(err, &perrs) || len(perrs) != 1 {
+		t.Fatalf("Parse() error = %v, want one ParseError", err)
+	}
+	if want := `SystemQueue_Ext(alias, "label", "description")`; perrs[0].Expected != want {
+		t.Errorf("expected = %q, want %q", perrs[0].Expected, want)
+	}
+}
+
+func TestParse_IgnoresDeploymentNodes(t *testing.T) {
+	content := `C4Deployment
+System_Boundary(shop, "Shop") {
+  Deployment_Node(cloud, "Cloud", "AWS") {
+    Node_L(eks, "EKS") {
+      System(orders, "Orders")
+    }
+  }
+}
+`
+	res, err := Parse(&MockFileReader{MockData: content}, "deploy.mmd", Options{Strict: true})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	objs := res.Diagram.Objects
+	if len(objs) != 2 || objs[1].Handle != "orders" || objs[1].Parent != "shop" {
+		t.Errorf("objects = %+v, want shop and orders inside it", objs)
+	}
+
+	_, err = Parse(&MockFileReader{MockData: "Node(eks, \"EKS\") {\n"}, "deploy.mmd", Options{Strict: true})
+	var perrs ParseErrors
+	if !errors.As(err, &perrs) || len(perrs) != 1 || perrs[0].Expected != "a closing }" {
+		t.Errorf("Parse() error = %v, want the node to need a closing }", err)
+	}
+}
+
+func TestParse_Strict(t *testing.T) {
+	content := `C4Context
+title Orders
+Person(user, "User")
+  Rel(user, app "calls")
+Sytem(app, "App")
+}
+System_Boundary(b, "B") {
+`
+	_, err := Parse(&MockFileReader{MockData: content}, "orders.mmd", Options{Strict: true})
+	var perrs ParseErrors
+	if !errors.As(err, &perrs) {
+		t.Fatalf("Parse() error = %v, want ParseErrors", err)
+	}
+
+	want := []ParseError{
+		{File: "orders.mmd", Line: 4, Column: 7, Text: `Rel(user, app "calls")`, Expected: `Rel(from, to, "label")`},
+		{File: "orders.mmd", Line: 5, Column: 1, Text: `Sytem(app, "App")`},
+		{File: "orders.mmd", Line: 6, Column: 1, Text: "}"},
+		{File: "orders.mmd", Line: 7, Column: 1, Text: `System_Boundary(b, "B") {`, Expected: "a closing }"},
+	}
+	if len(perrs) != len(want) {
+		t.Fatalf("got %d errors, want %d: %v", len(perrs), len(want), perrs)
+	}
+	for i, w := range want {
+		got := perrs[i]
+		if got.File != w.File || got.Line != w.Line || got.Column != w.Column || got.Text != w.Text {
+			t.Errorf("error %d = %+v, want %+v", i, got, w)
+		}
+		if w.Expected != "" && got.Expected != w.Expected {
+			t.Errorf("error %d expected = %q, want %q", i, got.Expected, w.Expected)
+		}
+	}
+	if !strings.Contains(err.Error(), "orders.mmd:4:7") {
+		t.Errorf("error message %q does not include position", err.Error())
+	}
+}
+
+func TestParse_Lenient(t *testing.T) {
+	content := `
+Person(user, "User")
+System(app, "App")
+Rel(user, app "calls")
+Rel_D(user, app, "Uses", "HTTPS")
+UpdateLayoutConfig($c4ShapeInRow="3")
+`
+	res, err := Parse(&MockFileReader{MockData: content}, "dummy.mmd", Options{})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(res.Diagram.Objects) != 2 || len(res.Diagram.Connections) != 1 {
+		t.Errorf("got %d objects and %d connections, want 2 and 1",
+			len(res.Diagram.Objects), len(res.Diagram.Connections))
+	}
+	if len(res.Warnings) != 1 || res.Warnings[0].Line != 4 {
+		t.Errorf("Warnings = %v, want one warning on line 4", res.Warnings)
+	}
+}
+
+func TestParse_Directives(t *testing.T) {
+	content := `C4Container
+%% icepanel: {"handleId":"Shop.v1"}
+System_Boundary(shop, "Shop") {
+  %% icepanel: {"handleId":"Orders","name":"Orders \"v2\"","properties":{"c4":null,"package":"shop.v1"}}
+  Container(orders, "Orders 'v2'", "", "")
+  Container(web, "Web", "", "")
+}
+%% icepanel: {"name":"places\norders"}
+Rel(web, orders, "places orders")
+%% a plain comment
+System(pay, "Payments")
+`
+	res, err := Parse(&MockFileReader{MockData: content}, "shop.mmd", Options{Strict: true})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	objs, conns := res.Diagram.Objects, res.Diagram.Connections
+	if len(objs) != 4 || objs[0].Handle != "Shop.v1" || objs[1].Name != `Orders "v2"` {
+		t.Fatalf("objects = %+v", objs)
+	}
+	if want := map[string]interface{}{"package": "shop.v1"}; !reflect.DeepEqual(objs[1].Props, want) {
+		t.Errorf("orders props = %v, want %v", objs[1].Props, want)
+	}
+	if objs[1].Type != "app" || objs[1].Parent != "Shop.v1" {
+		t.Errorf("orders = %+v, want the type and parent from the statement", objs[1])
+	}
+	if objs[2].Handle != "web" || objs[2].Parent != "Shop.v1" {
+		t.Errorf("web = %+v, want it under Shop.v1", objs[2])
+	}
+	if objs[3].Handle != "pay" || objs[3].Name != "Payments" {
+		t.Errorf("pay = %+v, want no directive applied", objs[3])
+	}
+	if len(conns) != 1 || conns[0].From != "web" || conns[0].To != "Orders" || conns[0].Label != "places\norders" {
+		t.Errorf("connections = %+v", conns)
+	}
+
+	_, err = Parse(&MockFileReader{MockData: "%% icepanel: {oops\nSystem(pay, \"Payments\")\n"}, "shop.mmd",
+		Options{Strict: true})
+	var perrs ParseErrors
+	if !errors.As(err, &perrs) || len(perrs) != 1 || perrs[0].Line != 1 || perrs[0].Column != 14 {
+		t.Errorf("Parse() error = %v, want one error at 1:14", err)
+	}
+}
+
 func TestSlug(t *testing.T) {
 	tests := []struct {
 		input string
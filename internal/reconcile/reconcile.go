@@ -0,0 +1,285 @@
+// Package reconcile computes and applies the changes needed to bring an IcePanel
+// version in line with a parsed diagram, without wiping the version first.
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"mermaid-icepanel/internal/api"
+)
+
+// Client is the subset of the IcePanel API used for reconciliation.
+type Client interface {
+	ListObjects(ctx context.Context, lc, ver string) ([]*api.Object, error)
+	ListConnections(ctx context.Context, lc, ver string) ([]*api.Connection, error)
+	CreateObjects(ctx context.Context, lc, ver string, objs []*api.Object) error
+	UpdateObjects(ctx context.Context, lc, ver string, objs []*api.Object) error
+	DeleteObjects(ctx context.Context, lc, ver string, objs []*api.Object) error
+	CreateConnections(ctx context.Context, lc, ver string, conns []*api.Connection) error
+	UpdateConnections(ctx context.Context, lc, ver string, conns map[string]*api.Connection) error
+	DeleteConnections(ctx context.Context, lc, ver string, handles []string) error
+}
+
+// ObjectUpdate describes a change to an object that exists on both sides.
+type ObjectUpdate struct {
+	Current *api.Object
+	Desired *api.Object
+	Changes map[string][2]interface{} // field -> [current, desired]
+}
+
+// ConnectionUpdate describes a change to a connection that exists on both sides.
+type ConnectionUpdate struct {
+	Current *api.Connection
+	Desired *api.Connection
+	Changes map[string][2]interface{} // field -> [current, desired]
+}
+
+// Plan lists the changes required to make the current model match the desired diagram.
+type Plan struct {
+	CreateObjects     []*api.Object
+	UpdateObjects     []*ObjectUpdate
+	DeleteObjects     []*api.Object
+	CreateConnections []*api.Connection
+	UpdateConnections []*ConnectionUpdate
+	DeleteConnections []*api.Connection
+}
+
+// Empty reports whether the plan contains no changes.
+func (p *Plan) Empty() bool {
+	return len(p.CreateObjects) == 0 && len(p.UpdateObjects) == 0 && len(p.DeleteObjects) == 0 &&
+		len(p.CreateConnections) == 0 && len(p.UpdateConnections) == 0 && len(p.DeleteConnections) == 0
+}
+
+// Compute builds a plan from the desired diagram and the current IcePanel model.
+// Objects are matched by handle. Connections are matched by endpoints, preferring
+// one with the same label; a match with a different label becomes an update.
+func Compute(desired *api.Diagram, objs []*api.Object, conns []*api.Connection) *Plan {
+	p := &Plan{}
+
+	current := make(map[string]*api.Object, len(objs))
+	for _, o := range objs {
+		current[o.Handle] = o
+	}
+	wanted := make(map[string]bool, len(desired.Objects))
+	for _, d := range desired.Objects {
+		wanted[d.Handle] = true
+		cur, ok := current[d.Handle]
+		if !ok {
+			p.CreateObjects = append(p.CreateObjects, d)
+			continue
+		}
+		if !cur.Equal(d) {
+			p.UpdateObjects = append(p.UpdateObjects, &ObjectUpdate{Current: cur, Desired: d, Changes: cur.Diff(d)})
+		}
+	}
+	for _, o := range objs {
+		if !wanted[o.Handle] {
+			p.DeleteObjects = append(p.DeleteObjects, o)
+		}
+	}
+
+	// Pair off identical connections first, then connections that only differ
+	// in label; whatever is left over on either side is created or deleted.
+	kept := make(map[string]bool)
+	unmatched := desired.Connections
+	for _, key := range []func(*api.Connection) string{connKey, endpointKey} {
+		pending := make(map[string][]*api.Connection)
+		for _, c := range conns {
+			if !kept[c.Handle] {
+				pending[key(c)] = append(pending[key(c)], c)
+			}
+		}
+		var rest []*api.Connection
+		for _, d := range unmatched {
+			cs := pending[key(d)]
+			if len(cs) == 0 {
+				rest = append(rest, d)
+				continue
+			}
+			cur := cs[0]
+			pending[key(d)] = cs[1:]
+			kept[cur.Handle] = true
+			if !cur.Equal(d) {
+				p.UpdateConnections = append(p.UpdateConnections,
+					&ConnectionUpdate{Current: cur, Desired: d, Changes: cur.Diff(d)})
+			}
+		}
+		unmatched = rest
+	}
+	for _, c := range conns {
+		if !kept[c.Handle] {
+			p.DeleteConnections = append(p.DeleteConnections, c)
+		}
+	}
+	// Parser handles are positional, so a new connection may reuse the handle
+	// of one that is being kept. Give those a fresh handle.
+	for _, d := range unmatched {
+		if kept[d.Handle] {
+			d = &api.Connection{Handle: freeHandle(d, kept), From: d.From, To: d.To, Label: d.Label}
+		}
+		kept[d.Handle] = true
+		p.CreateConnections = append(p.CreateConnections, d)
+	}
+
+	// Parents must exist before their children are created, and children
+	// must be gone before their parents are deleted.
+	sortByDepth(p.CreateObjects, desired.Objects, false)
+	sortByDepth(p.DeleteObjects, objs, true)
+	sort.Slice(p.UpdateObjects, func(i, j int) bool {
+		return p.UpdateObjects[i].Desired.Handle < p.UpdateObjects[j].Desired.Handle
+	})
+	return p
+}
+
+// Fetch reads the current model of a version and computes the plan against it.
+func Fetch(ctx context.Context, c Client, lc, ver string, desired *api.Diagram) (*Plan, error) {
+	objs, err := c.ListObjects(ctx, lc, ver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+	conns, err := c.ListConnections(ctx, lc, ver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list connections: %w", err)
+	}
+	return Compute(desired, objs, conns), nil
+}
+
+// Apply executes a plan. Connections are removed before the objects they may
+// reference, and objects are created before the connections that need them.
+// Each step runs concurrently within the client's configured limit.
+func Apply(ctx context.Context, c Client, lc, ver string, p *Plan) error {
+	handles := make([]string, len(p.DeleteConnections))
+	for i, conn := range p.DeleteConnections {
+		handles[i] = conn.Handle
+	}
+	if err := c.DeleteConnections(ctx, lc, ver, handles); err != nil {
+		return fmt.Errorf("failed to delete connections: %w", err)
+	}
+	if err := c.DeleteObjects(ctx, lc, ver, p.DeleteObjects); err != nil {
+		return fmt.Errorf("failed to delete objects: %w", err)
+	}
+	if err := c.CreateObjects(ctx, lc, ver, p.CreateObjects); err != nil {
+		return fmt.Errorf("failed to create objects: %w", err)
+	}
+	updates := make([]*api.Object, len(p.UpdateObjects))
+	for i, u := range p.UpdateObjects {
+		updates[i] = u.Desired
+	}
+	if err := c.UpdateObjects(ctx, lc, ver, updates); err != nil {
+		return fmt.Errorf("failed to update objects: %w", err)
+	}
+	// The desired connection may carry a different, positional handle; the
+	// update must keep the handle of the connection it replaces.
+	connUpdates := make(map[string]*api.Connection, len(p.UpdateConnections))
+	for _, u := range p.UpdateConnections {
+		conn := *u.Desired
+		conn.Handle = u.Current.Handle
+		connUpdates[u.Current.Handle] = &conn
+	}
+	if err := c.UpdateConnections(ctx, lc, ver, connUpdates); err != nil {
+		return fmt.Errorf("failed to update connections: %w", err)
+	}
+	if err := c.CreateConnections(ctx, lc, ver, p.CreateConnections); err != nil {
+		return fmt.Errorf("failed to create connections: %w", err)
+	}
+	return nil
+}
+
+// Write prints a human-readable summary of the plan.
+func (p *Plan) Write(w io.Writer) error {
+	ew := &errWriter{w: w}
+	ew.printf("Plan: %d to create, %d to update, %d to delete\n",
+		len(p.CreateObjects)+len(p.CreateConnections), len(p.UpdateObjects)+len(p.UpdateConnections),
+		len(p.DeleteObjects)+len(p.DeleteConnections))
+	for _, o := range p.CreateObjects {
+		ew.printf("  + object %s (%s) %q\n", o.Handle, o.Type, o.Name)
+	}
+	for _, u := range p.UpdateObjects {
+		ew.printf("  ~ object %s\n", u.Current.Handle)
+		ew.changes(u.Changes)
+	}
+	for _, o := range p.DeleteObjects {
+		ew.printf("  - object %s (%s) %q\n", o.Handle, o.Type, o.Name)
+	}
+	for _, c := range p.CreateConnections {
+		ew.printf("  + connection %s -> %s %q\n", c.From, c.To, c.Label)
+	}
+	for _, u := range p.UpdateConnections {
+		ew.printf("  ~ connection %s -> %s\n", u.Current.From, u.Current.To)
+		ew.changes(u.Changes)
+	}
+	for _, c := range p.DeleteConnections {
+		ew.printf("  - connection %s -> %s %q\n", c.From, c.To, c.Label)
+	}
+	return ew.err
+}
+
+func connKey(c *api.Connection) string {
+	return c.From + "\x00" + c.To + "\x00" + c.Label
+}
+
+func endpointKey(c *api.Connection) string {
+	return c.From + "\x00" + c.To
+}
+
+func freeHandle(c *api.Connection, used map[string]bool) string {
+	base := c.From + "-" + c.To
+	h := base
+	for i := 2; used[h]; i++ {
+		h = fmt.Sprintf("%s-%d", base, i)
+	}
+	return h
+}
+
+// sortByDepth orders objects by their nesting depth within model, then by
+// handle. With deepestFirst set, children come before their parents.
+func sortByDepth(objs, model []*api.Object, deepestFirst bool) {
+	parents := make(map[string]string, len(model))
+	for _, o := range model {
+		parents[o.Handle] = o.Parent
+	}
+	depth := func(o *api.Object) int {
+		d := 0
+		seen := map[string]bool{o.Handle: true}
+		for h := o.Parent; h != "" && !seen[h]; h = parents[h] {
+			seen[h] = true
+			d++
+		}
+		return d
+	}
+	sort.SliceStable(objs, func(i, j int) bool {
+		di, dj := depth(objs[i]), depth(objs[j])
+		if di != dj {
+			return (di < dj) != deepestFirst
+		}
+		return objs[i].Handle < objs[j].Handle
+	})
+}
+
+// errWriter remembers the first write error so output code stays linear.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) printf(format string, args ...interface{}) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = fmt.Fprintf(e.w, format, args...)
+}
+
+// changes prints field changes in a stable order.
+func (e *errWriter) changes(changes map[string][2]interface{}) {
+	fields := make([]string, 0, len(changes))
+	for f := range changes {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	for _, f := range fields {
+		e.printf("      %s: %v -> %v\n", f, changes[f][0], changes[f][1])
+	}
+}
@@ -0,0 +1,237 @@
+package reconcile
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mermaid-icepanel/internal/api"
+)
+
+// recordingClient implements Client and records every mutating call.
+type recordingClient struct {
+	objs  []*api.Object
+	conns []*api.Connection
+	calls []string
+}
+
+func (r *recordingClient) ListObjects(_ context.Context, _, _ string) ([]*api.Object, error) {
+	return r.objs, nil
+}
+
+func (r *recordingClient) ListConnections(_ context.Context, _, _ string) ([]*api.Connection, error) {
+	return r.conns, nil
+}
+
+func (r *recordingClient) CreateObjects(_ context.Context, _, _ string, objs []*api.Object) error {
+	for _, o := range objs {
+		r.calls = append(r.calls, "create object "+o.Handle)
+	}
+	return nil
+}
+
+func (r *recordingClient) UpdateObjects(_ context.Context, _, _ string, objs []*api.Object) error {
+	for _, o := range objs {
+		r.calls = append(r.calls, "update object "+o.Handle)
+	}
+	return nil
+}
+
+func (r *recordingClient) DeleteObjects(_ context.Context, _, _ string, objs []*api.Object) error {
+	for _, o := range objs {
+		r.calls = append(r.calls, "delete object "+o.Handle)
+	}
+	return nil
+}
+
+func (r *recordingClient) CreateConnections(_ context.Context, _, _ string, conns []*api.Connection) error {
+	for _, c := range conns {
+		r.calls = append(r.calls, "create connection "+c.Handle)
+	}
+	return nil
+}
+
+func (r *recordingClient) UpdateConnections(_ context.Context, _, _ string, conns map[string]*api.Connection) error {
+	for h := range conns {
+		r.calls = append(r.calls, "update connection "+h)
+	}
+	return nil
+}
+
+func (r *recordingClient) DeleteConnections(_ context.Context, _, _ string, handles []string) error {
+	for _, h := range handles {
+		r.calls = append(r.calls, "delete connection "+h)
+	}
+	return nil
+}
+
+func TestCompute(t *testing.T) {
+	desired := &api.Diagram{
+		Objects: []*api.Object{
+			{Handle: "user", Name: "User", Type: "actor"},
+			{Handle: "app", Name: "Application", Desc: "new", Type: "system"},
+			{Handle: "db", Name: "Database", Type: "store"},
+		},
+		Connections: []*api.Connection{
+			{Handle: "h0001", From: "user", To: "app", Label: "Uses"},
+			{Handle: "h0002", From: "app", To: "db", Label: "Reads"},
+		},
+	}
+	objs := []*api.Object{
+		{Handle: "user", Name: "User", Type: "actor"},
+		{Handle: "app", Name: "Application", Desc: "old", Type: "system"},
+		{Handle: "legacy", Name: "Legacy", Type: "system"},
+	}
+	conns := []*api.Connection{
+		{Handle: "h0002", From: "user", To: "app", Label: "Uses"},
+		{Handle: "h0001", From: "legacy", To: "app", Label: "Feeds"},
+	}
+
+	p := Compute(desired, objs, conns)
+
+	if got := handles(p.CreateObjects); !reflect.DeepEqual(got, []string{"db"}) {
+		t.Errorf("CreateObjects = %v, want [db]", got)
+	}
+	if len(p.UpdateObjects) != 1 || p.UpdateObjects[0].Current.Handle != "app" {
+		t.Fatalf("UpdateObjects = %+v, want app", p.UpdateObjects)
+	}
+	if ch := p.UpdateObjects[0].Changes["Desc"]; ch[0] != "old" || ch[1] != "new" {
+		t.Errorf("Desc change = %v, want [old new]", ch)
+	}
+	if got := handles(p.DeleteObjects); !reflect.DeepEqual(got, []string{"legacy"}) {
+		t.Errorf("DeleteObjects = %v, want [legacy]", got)
+	}
+	if len(p.DeleteConnections) != 1 || p.DeleteConnections[0].Handle != "h0001" {
+		t.Errorf("DeleteConnections = %+v, want h0001", p.DeleteConnections)
+	}
+	if len(p.CreateConnections) != 1 {
+		t.Fatalf("CreateConnections = %+v, want 1", p.CreateConnections)
+	}
+	// h0002 is kept for user -> app, so the new connection must not reuse it.
+	if c := p.CreateConnections[0]; c.Handle != "app-db" || c.From != "app" || c.To != "db" {
+		t.Errorf("CreateConnections[0] = %+v, want app-db", c)
+	}
+}
+
+func TestCompute_ConnectionLabelChange(t *testing.T) {
+	desired := &api.Diagram{Connections: []*api.Connection{
+		{Handle: "h0001", From: "a", To: "b", Label: "Reads"},
+		{Handle: "h0002", From: "a", To: "b", Label: "Writes"},
+	}}
+	conns := []*api.Connection{
+		{Handle: "c1", From: "a", To: "b", Label: "Writes"},
+		{Handle: "c2", From: "a", To: "b", Label: "Queries"},
+	}
+
+	p := Compute(desired, nil, conns)
+
+	if len(p.CreateConnections) != 0 || len(p.DeleteConnections) != 0 {
+		t.Errorf("expected no creates or deletes, got %+v / %+v", p.CreateConnections, p.DeleteConnections)
+	}
+	if len(p.UpdateConnections) != 1 {
+		t.Fatalf("UpdateConnections = %+v, want 1", p.UpdateConnections)
+	}
+	u := p.UpdateConnections[0]
+	if u.Current.Handle != "c2" || u.Changes["Label"] != [2]interface{}{"Queries", "Reads"} {
+		t.Errorf("update = %+v, want c2 Queries -> Reads", u)
+	}
+}
+
+func TestCompute_NoChanges(t *testing.T) {
+	objs := []*api.Object{{Handle: "app", Name: "App", Type: "system"}}
+	conns := []*api.Connection{{Handle: "h0001", From: "app", To: "app", Label: "Self"}}
+	desired := &api.Diagram{Objects: objs, Connections: conns}
+
+	if p := Compute(desired, objs, conns); !p.Empty() {
+		t.Errorf("expected empty plan, got %+v", p)
+	}
+}
+
+func TestCompute_ParentOrdering(t *testing.T) {
+	desired := &api.Diagram{Objects: []*api.Object{
+		{Handle: "a-comp", Type: "component", Parent: "m-app"},
+		{Handle: "m-app", Type: "app", Parent: "z-sys"},
+		{Handle: "z-sys", Type: "system"},
+	}}
+	current := []*api.Object{
+		{Handle: "old-sys", Type: "system"},
+		{Handle: "old-app", Type: "app", Parent: "old-sys"},
+	}
+
+	p := Compute(desired, current, nil)
+
+	if got := handles(p.CreateObjects); !reflect.DeepEqual(got, []string{"z-sys", "m-app", "a-comp"}) {
+		t.Errorf("CreateObjects = %v, want parents first", got)
+	}
+	if got := handles(p.DeleteObjects); !reflect.DeepEqual(got, []string{"old-app", "old-sys"}) {
+		t.Errorf("DeleteObjects = %v, want children first", got)
+	}
+}
+
+func TestFetchAndApply(t *testing.T) {
+	client := &recordingClient{
+		objs:  []*api.Object{{Handle: "old", Name: "Old", Type: "system"}, {Handle: "app", Name: "A", Type: "system"}},
+		conns: []*api.Connection{{Handle: "h0001", From: "old", To: "app", Label: "Calls"}},
+	}
+	desired := &api.Diagram{
+		Objects:     []*api.Object{{Handle: "app", Name: "App", Type: "system"}, {Handle: "new", Name: "New", Type: "system"}},
+		Connections: []*api.Connection{{Handle: "h0001", From: "new", To: "app", Label: "Calls"}},
+	}
+
+	p, err := Fetch(context.Background(), client, "l", "v", desired)
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if err := Apply(context.Background(), client, "l", "v", p); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	want := []string{
+		"delete connection h0001",
+		"delete object old",
+		"create object new",
+		"update object app",
+		"create connection h0001",
+	}
+	if !reflect.DeepEqual(client.calls, want) {
+		t.Errorf("calls = %v, want %v", client.calls, want)
+	}
+}
+
+func TestPlan_Write(t *testing.T) {
+	p := &Plan{
+		CreateObjects: []*api.Object{{Handle: "db", Name: "Database", Type: "store"}},
+		UpdateObjects: []*ObjectUpdate{{
+			Current: &api.Object{Handle: "app"},
+			Changes: map[string][2]interface{}{"Name": {"A", "App"}},
+		}},
+		DeleteConnections: []*api.Connection{{From: "a", To: "b", Label: "Calls"}},
+	}
+
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"Plan: 1 to create, 1 to update, 1 to delete",
+		`+ object db (store) "Database"`,
+		"~ object app",
+		"Name: A -> App",
+		`- connection a -> b "Calls"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func handles(objs []*api.Object) []string {
+	out := make([]string, len(objs))
+	for i, o := range objs {
+		out[i] = o.Handle
+	}
+	return out
+}
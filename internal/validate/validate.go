@@ -0,0 +1,88 @@
+// Package validate checks a parsed diagram for references IcePanel would reject.
+package validate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"mermaid-icepanel/internal/api"
+)
+
+// ObjectLister lists the objects that already exist in an IcePanel version.
+type ObjectLister interface {
+	ListObjects(ctx context.Context, lc, ver string) ([]*api.Object, error)
+}
+
+// DanglingRef is a connection whose endpoints include objects that do not exist.
+type DanglingRef struct {
+	Handle  string
+	From    string
+	To      string
+	Missing []string // endpoint handles that could not be found
+}
+
+// DanglingError lists every connection with a dangling endpoint.
+type DanglingError struct {
+	Refs []DanglingRef
+}
+
+func (e *DanglingError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d relationship(s) reference undeclared objects:", len(e.Refs))
+	for _, r := range e.Refs {
+		fmt.Fprintf(&b, "\n  %s -> %s: missing %s", r.From, r.To, strings.Join(r.Missing, ", "))
+	}
+	return b.String()
+}
+
+// Local checks that every connection endpoint is declared in the diagram itself.
+func Local(d *api.Diagram) error {
+	return check(d, nil)
+}
+
+// Remote checks that every connection endpoint is either declared in the
+// diagram or already exists in the given IcePanel version.
+func Remote(ctx context.Context, c ObjectLister, lc, ver string, d *api.Diagram) error {
+	objs, err := c.ListObjects(ctx, lc, ver)
+	if err != nil {
+		return fmt.Errorf("failed to list objects: %w", err)
+	}
+	return check(d, objs)
+}
+
+func check(d *api.Diagram, existing []*api.Object) error {
+	known := make(map[string]bool, len(d.Objects)+len(existing))
+	for _, o := range d.Objects {
+		known[o.Handle] = true
+	}
+	for _, o := range existing {
+		known[o.Handle] = true
+	}
+
+	var refs []DanglingRef
+	seen := make(map[string]bool)
+	for _, c := range d.Connections {
+		var missing []string
+		if !known[c.From] {
+			missing = append(missing, c.From)
+		}
+		if !known[c.To] && c.To != c.From {
+			missing = append(missing, c.To)
+		}
+		// BiRel yields a connection each way; report the pair once.
+		key := c.From + "\x00" + c.To
+		if c.To < c.From {
+			key = c.To + "\x00" + c.From
+		}
+		if len(missing) == 0 || seen[key+"\x00"+c.Label] {
+			continue
+		}
+		seen[key+"\x00"+c.Label] = true
+		refs = append(refs, DanglingRef{Handle: c.Handle, From: c.From, To: c.To, Missing: missing})
+	}
+	if len(refs) > 0 {
+		return &DanglingError{Refs: refs}
+	}
+	return nil
+}
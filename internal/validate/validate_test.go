@@ -0,0 +1,86 @@
+package validate
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mermaid-icepanel/internal/api"
+)
+
+type staticLister struct {
+	objs []*api.Object
+	err  error
+}
+
+func (s *staticLister) ListObjects(_ context.Context, _, _ string) ([]*api.Object, error) {
+	return s.objs, s.err
+}
+
+func testDiagram() *api.Diagram {
+	return &api.Diagram{
+		Objects: []*api.Object{{Handle: "user"}, {Handle: "app"}},
+		Connections: []*api.Connection{
+			{Handle: "h0001", From: "user", To: "app", Label: "Uses"},
+			{Handle: "h0002", From: "app", To: "payments", Label: "Charges"},
+			{Handle: "h0003", From: "app", To: "mail", Label: "Notifies"},
+			{Handle: "h0004", From: "mail", To: "app", Label: "Notifies"},
+		},
+	}
+}
+
+func TestLocal(t *testing.T) {
+	t.Run("all declared", func(t *testing.T) {
+		d := testDiagram()
+		d.Connections = d.Connections[:1]
+		if err := Local(d); err != nil {
+			t.Errorf("Local() error = %v", err)
+		}
+	})
+
+	t.Run("dangling references", func(t *testing.T) {
+		err := Local(testDiagram())
+		var derr *DanglingError
+		if !errors.As(err, &derr) {
+			t.Fatalf("Local() error = %v, want DanglingError", err)
+		}
+		want := []DanglingRef{
+			{Handle: "h0002", From: "app", To: "payments", Missing: []string{"payments"}},
+			{Handle: "h0003", From: "app", To: "mail", Missing: []string{"mail"}},
+		}
+		if !reflect.DeepEqual(derr.Refs, want) {
+			t.Errorf("Refs = %+v, want %+v", derr.Refs, want)
+		}
+		if !strings.Contains(err.Error(), "app -> payments: missing payments") {
+			t.Errorf("unexpected message: %v", err)
+		}
+	})
+}
+
+func TestRemote(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("existing objects satisfy references", func(t *testing.T) {
+		lister := &staticLister{objs: []*api.Object{{Handle: "payments"}, {Handle: "mail"}}}
+		if err := Remote(ctx, lister, "l", "v", testDiagram()); err != nil {
+			t.Errorf("Remote() error = %v", err)
+		}
+	})
+
+	t.Run("still missing", func(t *testing.T) {
+		lister := &staticLister{objs: []*api.Object{{Handle: "mail"}}}
+		var derr *DanglingError
+		if err := Remote(ctx, lister, "l", "v", testDiagram()); !errors.As(err, &derr) || len(derr.Refs) != 1 {
+			t.Errorf("Remote() error = %v, want one dangling reference", err)
+		}
+	})
+
+	t.Run("list error", func(t *testing.T) {
+		lister := &staticLister{err: errors.New("boom")}
+		if err := Remote(ctx, lister, "l", "v", testDiagram()); err == nil || !strings.Contains(err.Error(), "boom") {
+			t.Errorf("Remote() error = %v, want list error", err)
+		}
+	})
+}
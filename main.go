@@ -1,95 +1,215 @@
 // icepanel_sync.go
-// CLI tool: convert Mermaid C4 (System‑Context subset) to an IcePanel diagram and optionally wipe version.
-// Build: `go build -o icepanel-sync main.go`
+// CLI tool: sync Mermaid C4 (context, container, component) diagrams with IcePanel versions.
+// Build: `go build -o icepanel-sync .`
 // Usage:
 //
-//	icepanel-sync -mmd proveout.mmd -landscape 123 -version 456 \
+//	icepanel-sync <command> [flags]
+//
+//	icepanel-sync import -mmd proveout.mmd -landscape 123 -version 456 \
 //	    -token $ICEPANEL_TOKEN -name "Proveout System Context" -wipe -v
+//	icepanel-sync validate -mmd proveout.mmd
+//	icepanel-sync plan -mmd proveout.mmd -landscape 123 -version 456
+//	icepanel-sync apply -mmd proveout.mmd -landscape 123 -version 456
+//	icepanel-sync export -landscape 123 -version 456 -o proveout.mmd
+//
+// Run `icepanel-sync <command> -h` for the flags of each command.
 package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"strings"
 
 	"mermaid-icepanel/internal/api"
 	"mermaid-icepanel/internal/config"
 	"mermaid-icepanel/internal/parser"
 )
 
+const programName = "icepanel-sync"
+
+// command is a subcommand of the CLI.
+type command struct {
+	name    string
+	summary string
+	run     func(fs *flag.FlagSet, args []string, stdout io.Writer) error
+}
+
+var commands = []command{
+	{"import", "Upload a Mermaid diagram to a version, optionally wiping it first", runImport},
+	{"export", "Write the objects and connections of a version as Mermaid C4", runExport},
+	{"wipe", "Delete all objects, connections and diagrams in a version", runWipe},
+	{"validate", "Check a Mermaid diagram for parse errors and dangling relationships", runValidate},
+	{"diff", "Show how a version differs from a Mermaid diagram; fails if it does", runDiff},
+	{"plan", "Print the changes needed to sync a version with a Mermaid diagram", runPlan},
+	{"apply", "Make the planned changes to a version", runApply},
+	{"list", "List the objects and connections in a version", runList},
+}
+
 // ---------- main ----------
 
-func run() error {
-	// Define command line flags
-	mmdFile := flag.String("mmd", "", "Path to Mermaid .mmd file")
-	landscapeID := flag.String("landscape", "", "IcePanel landscape ID")
-	versionID := flag.String("version", "", "IcePanel version ID")
-	diagramName := flag.String("name", "Imported diagram", "Diagram name")
-	token := flag.String("token", "", "API token (falls back to ICEPANEL_TOKEN env var)")
-	wipe := flag.Bool("wipe", false, "Delete existing content before import")
-	verbose := flag.Bool("v", false, "Verbose output")
-	flag.Parse()
-
-	// Check required fields
-	if *mmdFile == "" || *landscapeID == "" || *versionID == "" {
-		flag.Usage()
-		return &requiredFieldError{msg: "Required fields: -mmd, -landscape, -version"}
-	}
-
-	// Configuration
-	cfg := config.NewConfig()
-
-	// Check token before setting up context
-	if *token == "" && cfg.DefaultToken == "" {
-		return &tokenError{
-			msg: "API token is required. Provide it with -token flag " +
-				"or set ICEPANEL_TOKEN environment variable",
+// run executes the CLI with the given arguments, writing command output to stdout.
+func run(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		usage(os.Stderr)
+		return &requiredFieldError{msg: "a command is required"}
+	}
+	name := args[0]
+	switch {
+	case name == "help" || name == "-h" || name == "-help" || name == "--help":
+		usage(os.Stderr)
+		return flag.ErrHelp
+	case strings.HasPrefix(name, "-"):
+		// Before subcommands existed every invocation was an import.
+		log.Printf("WARNING: running without a command is deprecated, use %s import", programName)
+		name, args = "import", append([]string{"import"}, args...)
+	}
+	for _, c := range commands {
+		if c.name == name {
+			return c.run(newFlagSet(c), args[1:], stdout)
 		}
 	}
+	usage(os.Stderr)
+	return &requiredFieldError{msg: fmt.Sprintf("unknown command %q", name)}
+}
+
+// usage prints the list of commands.
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s <command> [flags]\n\nCommands:\n", programName)
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-9s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(w, "\nRun '%s <command> -h' for the flags of a command.\n", programName)
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), cfg.RequestTimeout)
-	defer cancel()
+// newFlagSet returns the flag set of a command with a usage message naming
+// the command and its summary.
+func newFlagSet(c command) *flag.FlagSet {
+	fs := flag.NewFlagSet(programName+" "+c.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s [flags]\n\n%s.\n\nFlags:\n", programName, c.name, c.summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
 
-	httpClient := &api.DefaultHTTPClient{
-		Client: http.DefaultClient,
+// requireFlags reports a usage error naming every listed flag that is empty.
+func requireFlags(fs *flag.FlagSet, names ...string) error {
+	var missing []string
+	for _, n := range names {
+		if fs.Lookup(n).Value.String() == "" {
+			missing = append(missing, "-"+n)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
 	}
-	icepanelClient := api.NewIcePanelClient(cfg, httpClient, *token)
+	fs.Usage()
+	return &requiredFieldError{msg: "Required fields: " + strings.Join(missing, ", ")}
+}
+
+// versionFlags are the flags shared by commands that talk to an IcePanel version.
+type versionFlags struct {
+	landscape string
+	version   string
+	token     string
+	profile   string
+	verbose   bool
+	cfg       *config.Config
+}
 
-	// Parse mermaid file
-	diagram, err := parser.ParseMermaid(&parser.DefaultFileReader{}, *mmdFile)
+func (v *versionFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&v.landscape, "landscape", "", "IcePanel landscape ID (falls back to the profile)")
+	fs.StringVar(&v.version, "version", "", "IcePanel version ID (falls back to the profile)")
+	fs.StringVar(&v.token, "token", "", "API token (falls back to ICEPANEL_TOKEN env var, then the profile)")
+	fs.StringVar(&v.profile, "profile", "", "Config profile (falls back to ICEPANEL_PROFILE, then default_profile)")
+	fs.BoolVar(&v.verbose, "v", false, "Verbose output")
+}
+
+// parse parses the command line, loads the configuration for the selected
+// profile and fills in the flags that were not given from it.
+func (v *versionFlags) parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := config.Load(v.profile)
 	if err != nil {
 		return err
 	}
+	v.cfg = cfg
 
-	// Set diagram name from command line
-	diagram.Name = *diagramName
-
-	// Wipe existing content if requested
-	if *wipe {
-		if *verbose {
-			log.Printf("Wiping existing content in landscape %s, version %s", *landscapeID, *versionID)
-		}
-		if err := icepanelClient.WipeVersion(ctx, *landscapeID, *versionID); err != nil {
-			return err
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for name, value := range map[string]string{
+		"landscape": cfg.LandscapeID,
+		"version":   cfg.VersionID,
+		"name":      cfg.DiagramName,
+	} {
+		if fs.Lookup(name) != nil && !given[name] && value != "" {
+			if err := fs.Set(name, value); err != nil {
+				return err
+			}
 		}
 	}
+	return nil
+}
 
-	// Upload diagram
-	if *verbose {
-		log.Printf("Uploading diagram '%s' with %d objects and %d connections",
-			diagram.Name, len(diagram.Objects), len(diagram.Connections))
+// connect returns a client and a context bounded by the run timeout.
+// Callers must call the returned cancel function.
+func (v *versionFlags) connect() (context.Context, context.CancelFunc, *api.IcePanelClient, error) {
+	client, err := newClient(v.cfg, v.token)
+	if err != nil {
+		return nil, nil, nil, err
 	}
-
-	if err := icepanelClient.PostDiagram(ctx, *landscapeID, *versionID, diagram, *verbose); err != nil {
-		return err
+	if v.cfg.RunTimeout == 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		return ctx, cancel, client, nil
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), v.cfg.RunTimeout)
+	return ctx, cancel, client, nil
+}
 
-	if *verbose {
-		log.Println("Import completed successfully")
+// newClient builds an IcePanel client, requiring a token from the flag or
+// the environment.
+func newClient(cfg *config.Config, token string) (*api.IcePanelClient, error) {
+	if token == "" && cfg.DefaultToken == "" {
+		return nil, &tokenError{
+			msg: "API token is required. Provide it with -token flag, " +
+				"set ICEPANEL_TOKEN environment variable or configure a profile",
+		}
 	}
+	httpClient := api.NewRetryingHTTPClient(&api.DefaultHTTPClient{
+		Client: &http.Client{Timeout: cfg.RequestTimeout},
+	}, cfg.Retry)
+	return api.NewIcePanelClient(cfg, httpClient, token), nil
+}
 
-	return nil
+// mermaidFlags are the flags shared by commands that read a Mermaid file.
+type mermaidFlags struct {
+	file   string
+	strict bool
+}
+
+func (m *mermaidFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&m.file, "mmd", "", "Path to Mermaid .mmd file")
+	fs.BoolVar(&m.strict, "strict", false, "Fail on any Mermaid line that cannot be parsed")
+}
+
+// parse reads the Mermaid file, logging lines that were skipped.
+func (m *mermaidFlags) parse() (*api.Diagram, error) {
+	res, err := parser.Parse(&parser.DefaultFileReader{}, m.file, parser.Options{Strict: m.strict})
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range res.Warnings {
+		log.Printf("WARNING: skipped %v", w)
+	}
+	return res.Diagram, nil
 }
 
 // Define custom errors.
@@ -101,6 +221,15 @@ func (e *requiredFieldError) Error() string {
 	return e.msg
 }
 
+// driftError reports that a version does not match its Mermaid file.
+type driftError struct {
+	msg string
+}
+
+func (e *driftError) Error() string {
+	return e.msg
+}
+
 type tokenError struct {
 	msg string
 }
@@ -109,8 +238,24 @@ func (e *tokenError) Error() string {
 	return e.msg
 }
 
+// explain adds a hint for API failures the user can fix themselves.
+func explain(err error) error {
+	switch {
+	case errors.Is(err, api.ErrUnauthorized):
+		return fmt.Errorf("%w\nhint: check the -token flag or the ICEPANEL_TOKEN environment variable", err)
+	case errors.Is(err, api.ErrNotFound):
+		return fmt.Errorf("%w\nhint: check the -landscape and -version IDs", err)
+	case errors.Is(err, api.ErrRateLimited):
+		return fmt.Errorf("%w\nhint: IcePanel is rate limiting requests; retry later or raise ICEPANEL_MAX_RETRIES", err)
+	}
+	return err
+}
+
 func main() {
-	if err := run(); err != nil {
-		log.Fatalf("ERROR: %v", err)
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		log.Fatalf("ERROR: %v", explain(err))
 	}
 }
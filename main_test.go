@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mermaid-icepanel/internal/api"
+	"mermaid-icepanel/internal/api/apitest"
+)
+
+const testDiagram = `C4Container
+Person(user, "User", "A customer")
+System_Boundary(shop, "Shop") {
+  Container(web, "Web App", "Go", "Serves the UI")
+  ContainerDb(db, "Database", "Postgres", "Stores orders")
+}
+Rel(user, web, "Uses")
+Rel(web, db, "Reads from")
+`
+
+// setup starts a fake IcePanel API with version lc/v1, points the CLI at it
+// and writes the Mermaid source to a temporary file.
+func setup(t *testing.T, mermaid string) (*apitest.Server, string) {
+	t.Helper()
+	srv := apitest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.Token = "test-token"
+	srv.AddVersion("lc", "v1")
+
+	t.Setenv("ICEPANEL_API_URL", srv.URL)
+	t.Setenv("ICEPANEL_TOKEN", "test-token")
+	t.Setenv("ICEPANEL_MAX_RETRIES", "0")
+	t.Setenv("ICEPANEL_CONFIG", filepath.Join(t.TempDir(), "none.yaml"))
+	t.Setenv("ICEPANEL_PROFILE", "")
+
+	path := filepath.Join(t.TempDir(), "diagram.mmd")
+	if err := os.WriteFile(path, []byte(mermaid), 0o600); err != nil {
+		t.Fatalf("failed to write diagram: %v", err)
+	}
+	return srv, path
+}
+
+func TestRun_ImportWithWipe(t *testing.T) {
+	srv, path := setup(t, testDiagram)
+	srv.Seed("lc", "v1", apitest.KindObjects, &api.Object{Handle: "stale", Name: "Stale", Type: "app"})
+	srv.Seed("lc", "v1", apitest.KindDiagrams, map[string]string{"name": "Old diagram"})
+
+	args := []string{"import", "-mmd", path, "-landscape", "lc", "-version", "v1", "-name", "Shop", "-wipe"}
+	if err := run(args, &bytes.Buffer{}); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	objs := srv.Objects("lc", "v1")
+	var handles []string
+	for _, o := range objs {
+		handles = append(handles, o.Handle)
+	}
+	if got, want := strings.Join(handles, ","), "user,shop,web,db"; got != want {
+		t.Errorf("objects = %s, want %s", got, want)
+	}
+	if n := len(srv.Connections("lc", "v1")); n != 2 {
+		t.Errorf("connections = %d, want 2", n)
+	}
+	if n := srv.Count("lc", "v1", apitest.KindDiagrams); n != 1 {
+		t.Errorf("diagrams = %d, want 1", n)
+	}
+}
+
+func TestRun_ImportDryRun(t *testing.T) {
+	srv, path := setup(t, testDiagram)
+	srv.Seed("lc", "v1", apitest.KindObjects, &api.Object{Handle: "stale", Name: "Stale", Type: "app"})
+	args := []string{"import", "-mmd", path, "-landscape", "lc", "-version", "v1", "-name", "Shop", "-dry-run"}
+
+	var out bytes.Buffer
+	if err := run(append(args, "-wipe"), &out); err != nil {
+		t.Fatalf("run(-dry-run -wipe) error = %v", err)
+	}
+	for _, want := range []string{
+		"Wipe: 1 to delete", "- model/objects stale", `Post diagram "Shop": 4 objects, 2 connections`,
+		`+ object web (app) "Web App" in shop`, `+ connection web -> db "Reads from"`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("dry run output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := run(append(args, "-wipe", "-json"), &out); err != nil {
+		t.Fatalf("run(-dry-run -json) error = %v", err)
+	}
+	var report struct {
+		Wipe []struct {
+			Path string   `json:"path"`
+			IDs  []string `json:"ids"`
+		} `json:"wipe"`
+		Diagram api.Diagram `json:"diagram"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("dry run JSON is invalid: %v\n%s", err, out.String())
+	}
+	if len(report.Wipe) != 4 || len(report.Diagram.Objects) != 4 || report.Diagram.Name != "Shop" {
+		t.Errorf("dry run JSON = %s", out.String())
+	}
+
+	// Without -wipe nothing is read, so no token is needed.
+	t.Setenv("ICEPANEL_TOKEN", "")
+	if err := run(args, &bytes.Buffer{}); err != nil {
+		t.Fatalf("run(-dry-run) offline error = %v", err)
+	}
+
+	for _, r := range srv.Requests() {
+		if !strings.HasPrefix(r, "GET ") {
+			t.Errorf("dry run sent %s", r)
+		}
+	}
+	if n := srv.Count("lc", "v1", apitest.KindObjects); n != 1 {
+		t.Errorf("dry run changed the version: %d objects, want 1", n)
+	}
+}
+
+func TestRun_Profile(t *testing.T) {
+	srv, path := setup(t, testDiagram)
+	srv.AddVersion("lc", "from-profile")
+	t.Setenv("ICEPANEL_TOKEN", "")
+	t.Setenv("SHOP_TOKEN", "test-token")
+	cfgPath := filepath.Join(t.TempDir(), "config.yaml")
+	t.Setenv("ICEPANEL_CONFIG", cfgPath)
+	cfg := "profiles:\n  shop:\n    api_url: " + srv.URL + "\n    token_env: SHOP_TOKEN\n" +
+		"    landscape: lc\n    version: from-profile\n    diagram_name: Shop\n"
+	if err := os.WriteFile(cfgPath, []byte(cfg), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := run([]string{"import", "-profile", "shop", "-mmd", path}, &bytes.Buffer{}); err != nil {
+		t.Fatalf("run(import -profile) error = %v", err)
+	}
+	if n := srv.Count("lc", "from-profile", apitest.KindObjects); n != 4 {
+		t.Errorf("objects in profile version = %d, want 4", n)
+	}
+
+	// Flags take precedence over the profile.
+	if err := run([]string{"import", "-profile", "shop", "-mmd", path, "-version", "v1"}, &bytes.Buffer{}); err != nil {
+		t.Fatalf("run(import -profile -version) error = %v", err)
+	}
+	if n := srv.Count("lc", "v1", apitest.KindObjects); n != 4 {
+		t.Errorf("objects in flag version = %d, want 4", n)
+	}
+
+	if err := run([]string{"list", "-profile", "missing"}, &bytes.Buffer{}); err == nil {
+		t.Error("run(list -profile missing) succeeded")
+	}
+}
+
+func TestRun_LegacyFlagsImport(t *testing.T) {
+	srv, path := setup(t, testDiagram)
+	if err := run([]string{"-mmd", path, "-landscape", "lc", "-version", "v1"}, &bytes.Buffer{}); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if n := srv.Count("lc", "v1", apitest.KindObjects); n != 4 {
+		t.Errorf("objects = %d, want 4", n)
+	}
+}
+
+func TestRun_PlanDiffApply(t *testing.T) {
+	srv, path := setup(t, testDiagram)
+	srv.Seed("lc", "v1", apitest.KindObjects,
+		&api.Object{Handle: "user", Name: "Customer", Desc: "A customer", Type: "actor"},
+		&api.Object{Handle: "legacy", Name: "Legacy", Type: "system"})
+	args := []string{"-mmd", path, "-landscape", "lc", "-version", "v1"}
+
+	var out bytes.Buffer
+	if err := run(append([]string{"plan"}, args...), &out); err != nil {
+		t.Fatalf("run(plan) error = %v", err)
+	}
+	for _, want := range []string{"Plan: 5 to create, 1 to update, 1 to delete", "~ object user", "- object legacy"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("plan output missing %q:\n%s", want, out.String())
+		}
+	}
+	if n := srv.Count("lc", "v1", apitest.KindObjects); n != 2 {
+		t.Fatalf("plan changed the version: %d objects, want 2", n)
+	}
+
+	var drift *driftError
+	if err := run(append([]string{"diff"}, args...), &bytes.Buffer{}); !errors.As(err, &drift) {
+		t.Errorf("run(diff) error = %v, want driftError", err)
+	}
+
+	if err := run(append([]string{"apply"}, args...), &bytes.Buffer{}); err != nil {
+		t.Fatalf("run(apply) error = %v", err)
+	}
+	out.Reset()
+	if err := run(append([]string{"diff"}, args...), &out); err != nil {
+		t.Fatalf("run(diff) after apply error = %v", err)
+	}
+	if !strings.Contains(out.String(), "Plan: 0 to create, 0 to update, 0 to delete") {
+		t.Errorf("diff after apply is not empty:\n%s", out.String())
+	}
+}
+
+func TestRun_ApplyUpdatesConnectionLabel(t *testing.T) {
+	srv, path := setup(t, testDiagram)
+	srv.Seed("lc", "v1", apitest.KindConnections, &api.Connection{Handle: "c2", From: "web", To: "db", Label: "Reads"})
+	args := []string{"-mmd", path, "-landscape", "lc", "-version", "v1"}
+
+	if err := run(append([]string{"apply"}, args...), &bytes.Buffer{}); err != nil {
+		t.Fatalf("run(apply) error = %v", err)
+	}
+	var updated *api.Connection
+	for _, conn := range srv.Connections("lc", "v1") {
+		if conn.From == "web" && conn.To == "db" {
+			if updated != nil {
+				t.Fatalf("web -> db connected twice: %+v", srv.Connections("lc", "v1"))
+			}
+			updated = conn
+		}
+	}
+	if updated == nil || updated.Handle != "c2" || updated.Label != "Reads from" {
+		t.Errorf("connection = %+v, want c2 relabelled %q", updated, "Reads from")
+	}
+
+	var out bytes.Buffer
+	if err := run(append([]string{"diff"}, args...), &out); err != nil {
+		t.Errorf("run(diff) after apply error = %v\n%s", err, out.String())
+	}
+}
+
+func TestRun_ExportRoundTrip(t *testing.T) {
+	srv, path := setup(t, testDiagram)
+	if err := run([]string{"import", "-mmd", path, "-landscape", "lc", "-version", "v1"}, &bytes.Buffer{}); err != nil {
+		t.Fatalf("run(import) error = %v", err)
+	}
+
+	exported := filepath.Join(t.TempDir(), "exported.mmd")
+	if err := run([]string{"export", "-landscape", "lc", "-version", "v1", "-o", exported}, &bytes.Buffer{}); err != nil {
+		t.Fatalf("run(export) error = %v", err)
+	}
+	if err := run([]string{"diff", "-mmd", exported, "-landscape", "lc", "-version", "v1"}, &bytes.Buffer{}); err != nil {
+		t.Errorf("exported diagram does not match the version: %v", err)
+	}
+	if n := srv.Count("lc", "v1", apitest.KindObjects); n != 4 {
+		t.Errorf("objects = %d, want 4", n)
+	}
+}
+
+func TestRun_ExportRoundTripFromIcePanel(t *testing.T) {
+	srv, _ := setup(t, testDiagram)
+	srv.Seed("lc", "v1", apitest.KindObjects,
+		&api.Object{Handle: "Shop.v1", Name: "Shop", Type: "group"},
+		&api.Object{Handle: "service-Orders", Name: `Orders "v2"`, Desc: "Takes orders.\nSee the wiki.", Type: "app",
+			Parent: "Shop.v1", Props: map[string]interface{}{"package": "shop.v1"}},
+		&api.Object{Handle: "pay.v1", Name: "", Type: "system"})
+	srv.Seed("lc", "v1", apitest.KindConnections,
+		&api.Connection{Handle: "c1", From: "service-Orders", To: "pay.v1", Label: `charges "cards"`})
+
+	exported := filepath.Join(t.TempDir(), "exported.mmd")
+	if err := run([]string{"export", "-landscape", "lc", "-version", "v1", "-o", exported}, &bytes.Buffer{}); err != nil {
+		t.Fatalf("run(export) error = %v", err)
+	}
+	var out bytes.Buffer
+	if err := run([]string{"diff", "-mmd", exported, "-landscape", "lc", "-version", "v1"}, &out); err != nil {
+		t.Errorf("exported diagram does not match the version: %v\n%s", err, out.String())
+	}
+}
+
+func TestRun_ValidateWipeList(t *testing.T) {
+	srv, path := setup(t, testDiagram)
+	t.Setenv("ICEPANEL_TOKEN", "")
+
+	// validate works offline, without a token.
+	var out bytes.Buffer
+	if err := run([]string{"validate", "-mmd", path}, &out); err != nil {
+		t.Fatalf("run(validate) error = %v", err)
+	}
+	if !strings.Contains(out.String(), "4 objects, 2 connections") {
+		t.Errorf("validate output = %q", out.String())
+	}
+	bad := filepath.Join(t.TempDir(), "bad.mmd")
+	if err := os.WriteFile(bad, []byte(testDiagram+"Rel(user, nowhere, \"Calls\")\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := run([]string{"validate", "-mmd", bad}, &bytes.Buffer{}); err == nil {
+		t.Error("run(validate) accepted a dangling relationship")
+	}
+
+	t.Setenv("ICEPANEL_TOKEN", "test-token")
+	srv.Seed("lc", "v1", apitest.KindObjects, &api.Object{Handle: "shop", Name: "Shop", Type: "system"})
+	srv.Seed("lc", "v1", apitest.KindConnections, &api.Connection{Handle: "c1", From: "shop", To: "shop", Label: "Self"})
+	out.Reset()
+	if err := run([]string{"list", "-landscape", "lc", "-version", "v1"}, &out); err != nil {
+		t.Fatalf("run(list) error = %v", err)
+	}
+	for _, want := range []string{"shop    system  Shop", "c1      shop  shop  Self"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("list output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	if err := run([]string{"wipe", "-landscape", "lc", "-version", "v1"}, &bytes.Buffer{}); err != nil {
+		t.Fatalf("run(wipe) error = %v", err)
+	}
+	if n := srv.Count("lc", "v1", apitest.KindObjects); n != 0 {
+		t.Errorf("objects after wipe = %d, want 0", n)
+	}
+}
+
+func TestRun_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string // after the -mmd and -landscape flags
+		token   string
+		wantErr error
+	}{
+		{name: "unknown version", args: []string{"-version", "missing"}, wantErr: api.ErrNotFound},
+		{name: "bad token", args: []string{"-version", "v1"}, token: "wrong", wantErr: api.ErrUnauthorized},
+		{name: "command help", args: []string{"-h"}, wantErr: flag.ErrHelp},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, path := setup(t, testDiagram)
+			if tt.token != "" {
+				t.Setenv("ICEPANEL_TOKEN", tt.token)
+			}
+			args := append([]string{"plan", "-mmd", path, "-landscape", "lc"}, tt.args...)
+			if err := run(args, &bytes.Buffer{}); !errors.Is(err, tt.wantErr) {
+				t.Errorf("run() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := run([]string{"help"}, &bytes.Buffer{}); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("run(help) error = %v, want flag.ErrHelp", err)
+	}
+	var reqErr *requiredFieldError
+	for _, args := range [][]string{nil, {"bogus"}, {"plan", "-landscape", "lc"}} {
+		if err := run(args, &bytes.Buffer{}); !errors.As(err, &reqErr) {
+			t.Errorf("run(%q) error = %v, want requiredFieldError", args, err)
+		}
+	}
+}
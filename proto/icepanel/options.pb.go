@@ -0,0 +1,370 @@
+// IcePanel metadata for protoc-gen-icepanel.
+//
+// Import this file and annotate services, or whole files, to control how
+// they appear in IcePanel. Options take precedence over the classifier's
+// naming and comment heuristics; service options take precedence over file
+// options.
+//
+//   import "icepanel/options.proto";
+//
+//   option (icepanel.file) = {owner_team: "payments", tags: ["pci"]};
+//
+//   service PaymentProviderService {
+//     option (icepanel.service) = {
+//       type: SYSTEM
+//       external: false
+//       technology: "Go, gRPC"
+//       links: {name: "Runbook", url: "https://wiki.example.com/payments"}
+//     };
+//   }
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: icepanel/options.proto
+
+package icepanel
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	descriptorpb "google.golang.org/protobuf/types/descriptorpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// C4 type of a service.
+type C4Type int32
+
+const (
+	C4Type_C4_TYPE_UNSPECIFIED C4Type = 0 // classify with the heuristics
+	C4Type_SYSTEM              C4Type = 1
+	C4Type_SYSTEM_EXT          C4Type = 2
+	C4Type_SYSTEM_DB           C4Type = 3
+)
+
+// Enum value maps for C4Type.
+var (
+	C4Type_name = map[int32]string{
+		0: "C4_TYPE_UNSPECIFIED",
+		1: "SYSTEM",
+		2: "SYSTEM_EXT",
+		3: "SYSTEM_DB",
+	}
+	C4Type_value = map[string]int32{
+		"C4_TYPE_UNSPECIFIED": 0,
+		"SYSTEM":              1,
+		"SYSTEM_EXT":          2,
+		"SYSTEM_DB":           3,
+	}
+)
+
+func (x C4Type) Enum() *C4Type {
+	p := new(C4Type)
+	*p = x
+	return p
+}
+
+func (x C4Type) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (C4Type) Descriptor() protoreflect.EnumDescriptor {
+	return file_icepanel_options_proto_enumTypes[0].Descriptor()
+}
+
+func (C4Type) Type() protoreflect.EnumType {
+	return &file_icepanel_options_proto_enumTypes[0]
+}
+
+func (x C4Type) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use C4Type.Descriptor instead.
+func (C4Type) EnumDescriptor() ([]byte, []int) {
+	return file_icepanel_options_proto_rawDescGZIP(), []int{0}
+}
+
+// A link shown on the object in IcePanel.
+type Link struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Url           string                 `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Link) Reset() {
+	*x = Link{}
+	mi := &file_icepanel_options_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Link) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Link) ProtoMessage() {}
+
+func (x *Link) ProtoReflect() protoreflect.Message {
+	mi := &file_icepanel_options_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Link.ProtoReflect.Descriptor instead.
+func (*Link) Descriptor() ([]byte, []int) {
+	return file_icepanel_options_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Link) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Link) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+// IcePanel metadata for a service, or for every service in a file.
+type ObjectOptions struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Type       C4Type                 `protobuf:"varint,1,opt,name=type,proto3,enum=icepanel.C4Type" json:"type,omitempty"`
+	Technology string                 `protobuf:"bytes,2,opt,name=technology,proto3" json:"technology,omitempty"`
+	OwnerTeam  string                 `protobuf:"bytes,3,opt,name=owner_team,json=ownerTeam,proto3" json:"owner_team,omitempty"`
+	// Tags are added to those of the file.
+	Tags []string `protobuf:"bytes,4,rep,name=tags,proto3" json:"tags,omitempty"`
+	// Marks the service as external (SYSTEM becomes SYSTEM_EXT) or internal
+	// (SYSTEM_EXT becomes SYSTEM), whatever its type or classification.
+	External *bool `protobuf:"varint,5,opt,name=external,proto3,oneof" json:"external,omitempty"`
+	// Name shown in IcePanel instead of the service or package name.
+	DisplayName string `protobuf:"bytes,6,opt,name=display_name,json=displayName,proto3" json:"display_name,omitempty"`
+	// Links are added to those of the file.
+	Links         []*Link `protobuf:"bytes,7,rep,name=links,proto3" json:"links,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ObjectOptions) Reset() {
+	*x = ObjectOptions{}
+	mi := &file_icepanel_options_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ObjectOptions) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ObjectOptions) ProtoMessage() {}
+
+func (x *ObjectOptions) ProtoReflect() protoreflect.Message {
+	mi := &file_icepanel_options_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ObjectOptions.ProtoReflect.Descriptor instead.
+func (*ObjectOptions) Descriptor() ([]byte, []int) {
+	return file_icepanel_options_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ObjectOptions) GetType() C4Type {
+	if x != nil {
+		return x.Type
+	}
+	return C4Type_C4_TYPE_UNSPECIFIED
+}
+
+func (x *ObjectOptions) GetTechnology() string {
+	if x != nil {
+		return x.Technology
+	}
+	return ""
+}
+
+func (x *ObjectOptions) GetOwnerTeam() string {
+	if x != nil {
+		return x.OwnerTeam
+	}
+	return ""
+}
+
+func (x *ObjectOptions) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *ObjectOptions) GetExternal() bool {
+	if x != nil && x.External != nil {
+		return *x.External
+	}
+	return false
+}
+
+func (x *ObjectOptions) GetDisplayName() string {
+	if x != nil {
+		return x.DisplayName
+	}
+	return ""
+}
+
+func (x *ObjectOptions) GetLinks() []*Link {
+	if x != nil {
+		return x.Links
+	}
+	return nil
+}
+
+var file_icepanel_options_proto_extTypes = []protoimpl.ExtensionInfo{
+	{
+		ExtendedType:  (*descriptorpb.FileOptions)(nil),
+		ExtensionType: (*ObjectOptions)(nil),
+		Field:         50300,
+		Name:          "icepanel.file",
+		Tag:           "bytes,50300,opt,name=file",
+		Filename:      "icepanel/options.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.ServiceOptions)(nil),
+		ExtensionType: (*ObjectOptions)(nil),
+		Field:         50300,
+		Name:          "icepanel.service",
+		Tag:           "bytes,50300,opt,name=service",
+		Filename:      "icepanel/options.proto",
+	},
+}
+
+// Extension fields to descriptorpb.FileOptions.
+var (
+	// optional icepanel.ObjectOptions file = 50300;
+	E_File = &file_icepanel_options_proto_extTypes[0]
+)
+
+// Extension fields to descriptorpb.ServiceOptions.
+var (
+	// optional icepanel.ObjectOptions service = 50300;
+	E_Service = &file_icepanel_options_proto_extTypes[1]
+)
+
+var File_icepanel_options_proto protoreflect.FileDescriptor
+
+const file_icepanel_options_proto_rawDesc = "" +
+	"\n" +
+	"\x16icepanel/options.proto\x12\bicepanel\x1a google/protobuf/descriptor.proto\",\n" +
+	"\x04Link\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x10\n" +
+	"\x03url\x18\x02 \x01(\tR\x03url\"\xff\x01\n" +
+	"\rObjectOptions\x12$\n" +
+	"\x04type\x18\x01 \x01(\x0e2\x10.icepanel.C4TypeR\x04type\x12\x1e\n" +
+	"\n" +
+	"technology\x18\x02 \x01(\tR\n" +
+	"technology\x12\x1d\n" +
+	"\n" +
+	"owner_team\x18\x03 \x01(\tR\townerTeam\x12\x12\n" +
+	"\x04tags\x18\x04 \x03(\tR\x04tags\x12\x1f\n" +
+	"\bexternal\x18\x05 \x01(\bH\x00R\bexternal\x88\x01\x01\x12!\n" +
+	"\fdisplay_name\x18\x06 \x01(\tR\vdisplayName\x12$\n" +
+	"\x05links\x18\a \x03(\v2\x0e.icepanel.LinkR\x05linksB\v\n" +
+	"\t_external*L\n" +
+	"\x06C4Type\x12\x17\n" +
+	"\x13C4_TYPE_UNSPECIFIED\x10\x00\x12\n" +
+	"\n" +
+	"\x06SYSTEM\x10\x01\x12\x0e\n" +
+	"\n" +
+	"SYSTEM_EXT\x10\x02\x12\r\n" +
+	"\tSYSTEM_DB\x10\x03:K\n" +
+	"\x04file\x12\x1c.google.protobuf.FileOptions\x18\xfc\x88\x03 \x01(\v2\x17.icepanel.ObjectOptionsR\x04file:T\n" +
+	"\aservice\x12\x1f.google.protobuf.ServiceOptions\x18\xfc\x88\x03 \x01(\v2\x17.icepanel.ObjectOptionsR\aserviceB!Z\x1fmermaid-icepanel/proto/icepanelb\x06proto3"
+
+var (
+	file_icepanel_options_proto_rawDescOnce sync.Once
+	file_icepanel_options_proto_rawDescData []byte
+)
+
+func file_icepanel_options_proto_rawDescGZIP() []byte {
+	file_icepanel_options_proto_rawDescOnce.Do(func() {
+		file_icepanel_options_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_icepanel_options_proto_rawDesc), len(file_icepanel_options_proto_rawDesc)))
+	})
+	return file_icepanel_options_proto_rawDescData
+}
+
+var file_icepanel_options_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_icepanel_options_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_icepanel_options_proto_goTypes = []any{
+	(C4Type)(0),                         // 0: icepanel.C4Type
+	(*Link)(nil),                        // 1: icepanel.Link
+	(*ObjectOptions)(nil),               // 2: icepanel.ObjectOptions
+	(*descriptorpb.FileOptions)(nil),    // 3: google.protobuf.FileOptions
+	(*descriptorpb.ServiceOptions)(nil), // 4: google.protobuf.ServiceOptions
+}
+var file_icepanel_options_proto_depIdxs = []int32{
+	0, // 0: icepanel.ObjectOptions.type:type_name -> icepanel.C4Type
+	1, // 1: icepanel.ObjectOptions.links:type_name -> icepanel.Link
+	3, // 2: icepanel.file:extendee -> google.protobuf.FileOptions
+	4, // 3: icepanel.service:extendee -> google.protobuf.ServiceOptions
+	2, // 4: icepanel.file:type_name -> icepanel.ObjectOptions
+	2, // 5: icepanel.service:type_name -> icepanel.ObjectOptions
+	6, // [6:6] is the sub-list for method output_type
+	6, // [6:6] is the sub-list for method input_type
+	4, // [4:6] is the sub-list for extension type_name
+	2, // [2:4] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_icepanel_options_proto_init() }
+func file_icepanel_options_proto_init() {
+	if File_icepanel_options_proto != nil {
+		return
+	}
+	file_icepanel_options_proto_msgTypes[1].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_icepanel_options_proto_rawDesc), len(file_icepanel_options_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   2,
+			NumExtensions: 2,
+			NumServices:   0,
+		},
+		GoTypes:           file_icepanel_options_proto_goTypes,
+		DependencyIndexes: file_icepanel_options_proto_depIdxs,
+		EnumInfos:         file_icepanel_options_proto_enumTypes,
+		MessageInfos:      file_icepanel_options_proto_msgTypes,
+		ExtensionInfos:    file_icepanel_options_proto_extTypes,
+	}.Build()
+	File_icepanel_options_proto = out.File
+	file_icepanel_options_proto_goTypes = nil
+	file_icepanel_options_proto_depIdxs = nil
+}